@@ -0,0 +1,222 @@
+// Package arena 实现一个把 key 和 value 存放在大块预分配字节环中的缓存，
+// 索引只使用 map[uint64]uint32，不包含指针，大量缓存项时几乎不增加 GC 扫描负担。
+//
+// 每个分片是一个环形缓冲区，新数据写在尾部，空间不足时从头部淘汰最旧的数据，
+// 因此淘汰顺序是 FIFO 而不是严格的 LRU。
+package arena
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+const (
+	// entryLen(4) | hash(8) | keyLen(2)
+	headerSize = 14
+
+	maxShards    = 256
+	minShardSize = 64 << 10
+	maxKeyLen    = 1<<16 - 1
+)
+
+// Cache 是分片的字节环缓存，可以并发使用
+type Cache struct {
+	shards  []*shard
+	mask    uint64
+	onEvict func(key string, value []byte)
+}
+
+// New 创建总容量为 maxBytes 的缓存，onEvict 在数据因空间不足被淘汰时调用
+func New(maxBytes int64, onEvict func(key string, value []byte)) *Cache {
+	n := 1
+	for n < maxShards && int64(n*2)*minShardSize <= maxBytes {
+		n *= 2
+	}
+	c := &Cache{shards: make([]*shard, n), mask: uint64(n - 1), onEvict: onEvict}
+	size := 0
+	if maxBytes > 0 {
+		size = int(maxBytes / int64(n))
+	}
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			buf:   make([]byte, size),
+			index: make(map[uint64]uint32),
+		}
+	}
+	return c
+}
+
+func hashKey(key string) uint64 {
+	// FNV-1a，避免分配
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+func (c *Cache) shard(h uint64) *shard {
+	return c.shards[h&c.mask]
+}
+
+// Add 写入 key，单条数据超过分片容量时不缓存
+func (c *Cache) Add(key string, value []byte) {
+	if len(key) > maxKeyLen {
+		return
+	}
+	h := hashKey(key)
+	s := c.shard(h)
+	s.mu.Lock()
+	evicted := s.add(h, key, value, c.onEvict != nil)
+	s.mu.Unlock()
+	for _, e := range evicted {
+		c.onEvict(e.key, e.value)
+	}
+}
+
+// Get 返回 key 对应 value 的副本
+func (c *Cache) Get(key string) ([]byte, bool) {
+	h := hashKey(key)
+	s := c.shard(h)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(h, key)
+}
+
+// Remove 删除 key，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	h := hashKey(key)
+	s := c.shard(h)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.get(h, key); !ok {
+		return false
+	}
+	delete(s.index, h)
+	return true
+}
+
+// Len 返回缓存项数量
+func (c *Cache) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += len(s.index)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Bytes 返回环中已占用的字节数，包括被覆盖或删除但尚未回收的数据
+func (c *Cache) Bytes() int64 {
+	var n int64
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += int64(s.used)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+type evictedEntry struct {
+	key   string
+	value []byte
+}
+
+type shard struct {
+	mu    sync.Mutex
+	buf   []byte
+	index map[uint64]uint32
+	head  int // 最旧数据的位置
+	tail  int // 下一次写入的位置
+	used  int
+}
+
+// read 从环中 off 处读取 len(p) 字节，必要时绕回开头
+func (s *shard) read(p []byte, off int) {
+	n := copy(p, s.buf[off:])
+	copy(p[n:], s.buf)
+}
+
+func (s *shard) write(p []byte, off int) {
+	n := copy(s.buf[off:], p)
+	copy(s.buf, p[n:])
+}
+
+func (s *shard) header(off int) (size int, h uint64, keyLen int) {
+	var hdr [headerSize]byte
+	s.read(hdr[:], off)
+	return int(binary.LittleEndian.Uint32(hdr[0:4])),
+		binary.LittleEndian.Uint64(hdr[4:12]),
+		int(binary.LittleEndian.Uint16(hdr[12:14]))
+}
+
+func (s *shard) add(h uint64, key string, value []byte, collect bool) []evictedEntry {
+	size := headerSize + len(key) + len(value)
+	if size > len(s.buf) {
+		return nil
+	}
+
+	var evicted []evictedEntry
+	for len(s.buf)-s.used < size {
+		if e, ok := s.evictOldest(collect); ok {
+			evicted = append(evicted, e)
+		}
+	}
+
+	var hdr [headerSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:4], uint32(size))
+	binary.LittleEndian.PutUint64(hdr[4:12], h)
+	binary.LittleEndian.PutUint16(hdr[12:14], uint16(len(key)))
+	off := s.tail
+	s.write(hdr[:], off)
+	s.write([]byte(key), (off+headerSize)%len(s.buf))
+	s.write(value, (off+headerSize+len(key))%len(s.buf))
+
+	s.index[h] = uint32(off)
+	s.tail = (off + size) % len(s.buf)
+	s.used += size
+	return evicted
+}
+
+// evictOldest 回收头部的一条数据，数据仍有效时返回它
+func (s *shard) evictOldest(collect bool) (evictedEntry, bool) {
+	off := s.head
+	size, h, keyLen := s.header(off)
+	s.head = (off + size) % len(s.buf)
+	s.used -= size
+
+	if cur, ok := s.index[h]; !ok || int(cur) != off {
+		return evictedEntry{}, false
+	}
+	delete(s.index, h)
+	if !collect {
+		return evictedEntry{}, false
+	}
+	key := make([]byte, keyLen)
+	s.read(key, (off+headerSize)%len(s.buf))
+	value := make([]byte, size-headerSize-keyLen)
+	s.read(value, (off+headerSize+keyLen)%len(s.buf))
+	return evictedEntry{string(key), value}, true
+}
+
+func (s *shard) get(h uint64, key string) ([]byte, bool) {
+	off, ok := s.index[h]
+	if !ok {
+		return nil, false
+	}
+	size, _, keyLen := s.header(int(off))
+	// 哈希冲突时比较 key
+	if keyLen != len(key) {
+		return nil, false
+	}
+	k := make([]byte, keyLen)
+	s.read(k, (int(off)+headerSize)%len(s.buf))
+	if string(k) != key {
+		return nil, false
+	}
+	value := make([]byte, size-headerSize-keyLen)
+	s.read(value, (int(off)+headerSize+keyLen)%len(s.buf))
+	return value, true
+}
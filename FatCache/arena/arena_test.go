@@ -0,0 +1,104 @@
+package arena
+
+import (
+	"fatcache/lru"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAddGetRemove(t *testing.T) {
+	c := New(1024, nil)
+	c.Add("key1", []byte("value1"))
+	c.Add("key2", []byte("value2"))
+	c.Add("key1", []byte("newValue1"))
+
+	if v, ok := c.Get("key1"); !ok || string(v) != "newValue1" {
+		t.Fatalf("expected overwritten value, got %q", v)
+	}
+	if !c.Remove("key2") || c.Remove("key2") {
+		t.Fatalf("expected key2 to be removed exactly once")
+	}
+	if _, ok := c.Get("key2"); ok {
+		t.Fatalf("expected key2 to be gone")
+	}
+	if c.Len() != 1 {
+		t.Fatalf("expected 1 entry, got %d", c.Len())
+	}
+}
+
+func TestEvictionWrapAround(t *testing.T) {
+	var evicted []string
+	c := New(200, func(key string, value []byte) {
+		evicted = append(evicted, key+"="+string(value))
+	})
+	for i := 0; i < 100; i++ {
+		c.Add(fmt.Sprintf("key%02d", i), []byte(fmt.Sprintf("value%02d", i)))
+	}
+
+	// 每条数据 14+5+7 字节，容量 200 最多保留 7 条
+	if c.Len() != 7 {
+		t.Fatalf("expected 7 live entries, got %d", c.Len())
+	}
+	for i := 93; i < 100; i++ {
+		key := fmt.Sprintf("key%02d", i)
+		if v, ok := c.Get(key); !ok || string(v) != fmt.Sprintf("value%02d", i) {
+			t.Fatalf("expected %s to survive wrap-around, got %q", key, v)
+		}
+	}
+	if len(evicted) != 93 || evicted[0] != "key00=value00" {
+		t.Fatalf("unexpected evictions: %d, first %q", len(evicted), evicted[0])
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	c := New(32, nil)
+	c.Add("key", make([]byte, 64))
+	if _, ok := c.Get("key"); ok {
+		t.Fatalf("expected oversized entry to be rejected")
+	}
+}
+
+type bytesValue []byte
+
+func (b bytesValue) Len() int {
+	return len(b)
+}
+
+const gcEntries = 1_000_000
+
+// gcPause 返回在当前堆上执行一次完整 GC 的耗时
+func gcPause() time.Duration {
+	start := time.Now()
+	runtime.GC()
+	return time.Since(start)
+}
+
+func BenchmarkGCPauseArena(b *testing.B) {
+	c := New(256<<20, nil)
+	for i := 0; i < gcEntries; i++ {
+		c.Add(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	b.ResetTimer()
+	var total time.Duration
+	for i := 0; i < b.N; i++ {
+		total += gcPause()
+	}
+	b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "gc-ns/op")
+	runtime.KeepAlive(c)
+}
+
+func BenchmarkGCPauseLRU(b *testing.B) {
+	c := lru.New(256<<20, nil)
+	for i := 0; i < gcEntries; i++ {
+		c.Add(fmt.Sprintf("key%d", i), bytesValue("value"))
+	}
+	b.ResetTimer()
+	var total time.Duration
+	for i := 0; i < b.N; i++ {
+		total += gcPause()
+	}
+	b.ReportMetric(float64(total.Nanoseconds())/float64(b.N), "gc-ns/op")
+	runtime.KeepAlive(c)
+}
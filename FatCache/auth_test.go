@@ -0,0 +1,174 @@
+package fatcache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCA 生成测试用的 CA，并用它签发 127.0.0.1 的节点证书
+func newTestCA(t *testing.T) (*x509.CertPool, func(cn string) tls.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fatcache test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	serial := int64(1)
+	issue := func(cn string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serial++
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	return pool, issue
+}
+
+func TestHTTPPoolMutualTLS(t *testing.T) {
+	NewGroup("tlsGroup", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("Value for " + key), nil
+	}))
+	ca, issue := newTestCA(t)
+
+	remote := NewHTTPPoolOpts("remote", &HTTPPoolOptions{TLS: &MutualTLS{Cert: issue("remote"), CA: ca}})
+	server := httptest.NewUnstartedServer(remote)
+	server.TLS = remote.NewServer("").TLSConfig
+	server.StartTLS()
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{TLS: &MutualTLS{Cert: issue("self"), CA: ca}})
+	pool.Set(addr)
+	peer, _ := pool.PickPeer("key")
+	value, err := peer.Get("tlsGroup", "key")
+	if err != nil {
+		t.Fatalf("Error getting value over mTLS: %v", err)
+	}
+	if string(value) != "Value for key" {
+		t.Fatalf("Unexpected value, got %s", value)
+	}
+
+	// 没有客户端证书的请求在握手阶段被拒绝
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca}}}
+	if resp, err := client.Get(server.URL + defaultBasePath + "tlsGroup/key"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected request without client certificate to fail")
+	}
+}
+
+func TestHTTPPoolSharedSecret(t *testing.T) {
+	NewGroup("hmacGroup", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("Value for " + key), nil
+	}))
+	secret := []byte("s3cret")
+	server := httptest.NewServer(NewHTTPPoolOpts("remote", &HTTPPoolOptions{Secret: secret}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{Secret: secret})
+	pool.Set(addr)
+	peer, _ := pool.PickPeer("key")
+	if _, err := peer.Get("hmacGroup", "key"); err != nil {
+		t.Fatalf("Error getting value with signed request: %v", err)
+	}
+
+	wrong := NewHTTPPoolOpts("self", &HTTPPoolOptions{Secret: []byte("wrong")})
+	wrong.Set(addr)
+	peer, _ = wrong.PickPeer("key")
+	if _, err := peer.Get("hmacGroup", "key"); err == nil {
+		t.Fatalf("expected request signed with wrong secret to be rejected")
+	}
+
+	resp, err := http.Get(server.URL + defaultBasePath + "hmacGroup/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unsigned request, got %d", resp.StatusCode)
+	}
+}
+
+func TestPeerAuthReplay(t *testing.T) {
+	auth := newPeerAuth([]byte("s3cret"), time.Minute)
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath+"g/key", nil)
+	if err := auth.sign(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.verify(req); err != nil {
+		t.Fatalf("expected signed request to verify: %v", err)
+	}
+	if err := auth.verify(req); err == nil {
+		t.Fatalf("expected replayed request to be rejected")
+	}
+
+	stale := httptest.NewRequest(http.MethodGet, defaultBasePath+"g/key", nil)
+	auth.sign(stale)
+	auth.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if err := auth.verify(stale); err == nil {
+		t.Fatalf("expected request outside the replay window to be rejected")
+	}
+}
+
+func TestPeerAuthCoversQueryAndGeneration(t *testing.T) {
+	auth := newPeerAuth([]byte("s3cret"), time.Minute)
+	tampered := func(mutate func(r *http.Request)) error {
+		req := httptest.NewRequest(http.MethodGet, defaultBasePath+"_control/events/?since=3&epoch=abc", nil)
+		req.Header.Set(headerGeneration, "1")
+		if err := auth.sign(req); err != nil {
+			t.Fatal(err)
+		}
+		mutate(req)
+		return auth.verify(req)
+	}
+	if err := tampered(func(r *http.Request) {}); err != nil {
+		t.Fatalf("expected untouched request to verify: %v", err)
+	}
+	if err := tampered(func(r *http.Request) { r.Header.Set(headerGeneration, "18446744073709551615") }); err == nil {
+		t.Fatalf("expected request with altered generation to be rejected")
+	}
+	if err := tampered(func(r *http.Request) { r.URL.RawQuery = "since=0&epoch=abc" }); err == nil {
+		t.Fatalf("expected request with altered query to be rejected")
+	}
+}
@@ -0,0 +1,128 @@
+package fatcache
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// BatchGetter 一次加载多个 key，返回结果中没有的 key 视为加载失败
+type BatchGetter interface {
+	GetBatch(keys []string) (map[string][]byte, error)
+}
+
+type BatchGetterFunc func(keys []string) (map[string][]byte, error)
+
+// 实现 BatchGetter 接口
+func (f BatchGetterFunc) GetBatch(keys []string) (map[string][]byte, error) {
+	return f(keys)
+}
+
+// BatchOptions 配置批量加载，零值字段使用默认值
+type BatchOptions struct {
+	// Window 第一个未命中的 key 到达后等待其他 key 的时间，默认 2ms
+	Window time.Duration
+	// MaxKeys 每批最多的 key 数量，达到后立即加载，默认 100
+	MaxKeys int
+}
+
+// WithBatchGetter 让 Group 在本地加载时把并发的未命中合并为一次 GetBatch 调用。
+// 同一 key 的并发请求仍由 singleflight 合并，每个 key 在一批中只出现一次。
+// 设置后本地加载不再调用 Group 的 Getter，即使它实现了 TaggedGetter，批量加载的数据也不带标签，
+// 需要按标签失效的数据应使用 SetTagged 写入
+func WithBatchGetter(b BatchGetter, opts BatchOptions) GroupOption {
+	return func(g *Group) {
+		if opts.Window <= 0 {
+			opts.Window = 2 * time.Millisecond
+		}
+		if opts.MaxKeys <= 0 {
+			opts.MaxKeys = 100
+		}
+		g.batcher = &batchLoader{group: g, getter: b, opts: opts}
+	}
+}
+
+// batchLoader 在时间窗口内收集 key，凑满一批或窗口结束时调用 GetBatch
+type batchLoader struct {
+	group  *Group
+	getter BatchGetter
+	opts   BatchOptions
+
+	mu      sync.Mutex
+	pending *batch
+}
+
+type batch struct {
+	keys []string
+	// queued 为 keys 中已有的 key：本地请求与转发来的请求使用不同的 singleflight key，
+	// 同一 key 可能被加入两次
+	queued  map[string]struct{}
+	started bool
+	done    chan struct{}
+	values  map[string][]byte
+	err     error
+}
+
+// load 把 key 加入当前批次并等待结果，ctx 结束时不再等待，批次仍会加载
+func (b *batchLoader) load(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	bt := b.pending
+	if bt == nil {
+		bt = &batch{done: make(chan struct{}), queued: make(map[string]struct{})}
+		b.pending = bt
+		time.AfterFunc(b.opts.Window, func() { b.dispatch(bt) })
+	}
+	if _, ok := bt.queued[key]; !ok {
+		bt.queued[key] = struct{}{}
+		bt.keys = append(bt.keys, key)
+	}
+	full := len(bt.keys) >= b.opts.MaxKeys
+	b.mu.Unlock()
+
+	if full {
+		b.dispatch(bt)
+	}
+	select {
+	case <-bt.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if bt.err != nil {
+		return nil, bt.err
+	}
+	value, ok := bt.values[key]
+	if !ok {
+		return nil, fmt.Errorf("key %s not returned by batch getter", key)
+	}
+	return value, nil
+}
+
+// dispatch 加载一批 key，窗口结束和批次已满可能同时触发，只执行一次。
+// GetBatch 中的 panic 转换为 PanicError 返回给这一批的所有调用方，done 总会被关闭
+func (b *batchLoader) dispatch(bt *batch) {
+	b.mu.Lock()
+	if b.pending == bt {
+		b.pending = nil
+	}
+	if bt.started {
+		b.mu.Unlock()
+		return
+	}
+	bt.started = true
+	b.mu.Unlock()
+
+	defer close(bt.done)
+	defer func() {
+		if v := recover(); v != nil {
+			bt.values, bt.err = nil, &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	b.group.stats.batchLoads.Add(1)
+	b.group.stats.batchedKeys.Add(int64(len(bt.keys)))
+	bt.values, bt.err = b.getter.GetBatch(bt.keys)
+}
@@ -0,0 +1,167 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBatchGetter(t *testing.T) {
+	var calls atomic.Int32
+	var mu sync.Mutex
+	var batches [][]string
+	batcher := BatchGetterFunc(func(keys []string) (map[string][]byte, error) {
+		calls.Add(1)
+		mu.Lock()
+		batches = append(batches, append([]string(nil), keys...))
+		mu.Unlock()
+		values := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			if key != "missing" {
+				values[key] = []byte("batch:" + key)
+			}
+		}
+		return values, nil
+	})
+	group := NewGroup("batchGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		t.Errorf("unexpected single-key load for %s", key)
+		return nil, fmt.Errorf("unexpected")
+	}), WithBatchGetter(batcher, BatchOptions{Window: 20 * time.Millisecond, MaxKeys: 4}))
+
+	// 10 个不同的 key，每个 key 两个并发请求，最多 4 个一批
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i%10)
+			value, err := group.Get(key)
+			if err != nil || value.String() != "batch:"+key {
+				t.Errorf("unexpected value %q for %s, err %v", value.String(), key, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := map[string]bool{}
+	for _, b := range batches {
+		if len(b) > 4 {
+			t.Fatalf("batch exceeds MaxKeys: %v", b)
+		}
+		for _, key := range b {
+			if seen[key] {
+				t.Fatalf("key %s loaded twice", key)
+			}
+			seen[key] = true
+		}
+	}
+	if len(seen) != 10 || calls.Load() < 3 || calls.Load() > 10 {
+		t.Fatalf("unexpected batches: %v", batches)
+	}
+	stats := group.Stats()
+	if stats.BatchLoads != int64(calls.Load()) || stats.BatchedKeys != 10 {
+		t.Fatalf("unexpected batch stats: %+v", stats)
+	}
+
+	// 批量结果中没有的 key 返回错误
+	if _, err := group.Get("missing"); err == nil {
+		t.Fatalf("expected error for key missing from batch result")
+	}
+}
+
+func TestBatchGetterContext(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	group := NewGroup("batchCtxGroup", 1<<20, nil,
+		WithBatchGetter(BatchGetterFunc(func(keys []string) (map[string][]byte, error) {
+			mu.Lock()
+			batches = append(batches, append([]string(nil), keys...))
+			mu.Unlock()
+			values := make(map[string][]byte, len(keys))
+			for _, key := range keys {
+				values[key] = []byte(key)
+			}
+			return values, nil
+		}), BatchOptions{Window: 200 * time.Millisecond}))
+
+	// 等待批次时 ctx 到期立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := group.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected GetContext to return when ctx expires, took %v", elapsed)
+	}
+
+	// 本地请求和转发来的请求分别进入 singleflight，同一 key 在一批中只出现一次
+	var wg sync.WaitGroup
+	for _, c := range []context.Context{context.Background(), withForwarded(context.Background())} {
+		wg.Add(1)
+		go func(ctx context.Context) {
+			defer wg.Done()
+			if v, err := group.GetContext(ctx, "dup"); err != nil || v.String() != "dup" {
+				t.Errorf("unexpected value %q, err %v", v.String(), err)
+			}
+		}(c)
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	for _, b := range batches {
+		seen := map[string]bool{}
+		for _, key := range b {
+			if seen[key] {
+				t.Fatalf("expected duplicate keys to be merged, got %v", b)
+			}
+			seen[key] = true
+		}
+	}
+}
+
+func TestBatchGetterError(t *testing.T) {
+	group := NewGroup("batchErrGroup", 1<<20, nil,
+		WithBatchGetter(BatchGetterFunc(func(keys []string) (map[string][]byte, error) {
+			return nil, fmt.Errorf("backend down")
+		}), BatchOptions{Window: time.Millisecond}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := group.Get(fmt.Sprintf("key%d", i)); err == nil {
+				t.Errorf("expected batch error to reach every waiter")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if group.Stats().LocalLoadErrs != 5 {
+		t.Fatalf("unexpected stats: %+v", group.Stats())
+	}
+}
+
+func TestBatchGetterPanic(t *testing.T) {
+	group := NewGroup("batchPanicGroup", 1<<20, nil,
+		WithBatchGetter(BatchGetterFunc(func(keys []string) (map[string][]byte, error) {
+			panic("boom")
+		}), BatchOptions{Window: time.Millisecond, MaxKeys: 3}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var perr *PanicError
+			if _, err := group.Get(fmt.Sprintf("key%d", i)); !errors.As(err, &perr) {
+				t.Errorf("expected panic in GetBatch to be returned as PanicError, got %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,134 @@
+package fatcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen 表示远端节点的熔断器处于打开状态，请求未被发出
+var ErrCircuitOpen = errors.New("fatcache: peer circuit breaker is open")
+
+const (
+	defaultBreakerThreshold   = 5
+	defaultBreakerOpenTimeout = 5 * time.Second
+)
+
+// BreakerOptions 配置每个远端节点的熔断器
+type BreakerOptions struct {
+	// FailureThreshold 连续失败多少次后打开熔断器，小于 0 表示关闭熔断
+	FailureThreshold int
+	// OpenTimeout 熔断器打开后多久进入半开状态，放行一个探测请求
+	OpenTimeout time.Duration
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	timeout   time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+func newCircuitBreaker(opts BreakerOptions) *circuitBreaker {
+	b := &circuitBreaker{
+		threshold: opts.FailureThreshold,
+		timeout:   opts.OpenTimeout,
+		now:       time.Now,
+	}
+	if b.threshold == 0 {
+		b.threshold = defaultBreakerThreshold
+	}
+	if b.timeout <= 0 {
+		b.timeout = defaultBreakerOpenTimeout
+	}
+	return b
+}
+
+// allow 判断当前是否可以向节点发请求，半开状态下只放行一个探测请求
+func (b *circuitBreaker) allow() bool {
+	if b.threshold < 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.timeout {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	if b.threshold < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// cancel 用于被取消的请求，不影响熔断统计，只释放半开状态的探测名额
+func (b *circuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) snapshot() (BreakerState, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state := b.state
+	if state == BreakerOpen && b.now().Sub(b.openedAt) >= b.timeout {
+		state = BreakerHalfOpen
+	}
+	return state, b.failures
+}
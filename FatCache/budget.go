@@ -0,0 +1,137 @@
+package fatcache
+
+import (
+	"fatcache/lru"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// lruEntryOverhead 是默认 lru 存储中每个缓存项的估算额外开销，
+// 包括 lru 自身的结构以及装箱到接口中的 ByteView
+var lruEntryOverhead = lru.EntryOverhead + int64(unsafe.Sizeof(ByteView{}))
+
+// WithMemoryAccounting 让默认的 lru 存储在 key 和 value 之外计入每个缓存项的估算额外开销，
+// cacheBytes 因此更接近实际占用的内存。使用 WithStore 替换的存储不受影响
+func WithMemoryAccounting() GroupOption {
+	return func(g *Group) {
+		g.mainCache.overhead = lruEntryOverhead
+	}
+}
+
+// MemoryBudget 是多个 Group 共享的内存上限。
+// 总占用超过上限时，从占用最多的 Group 中淘汰最旧的数据，直到回到上限以内
+type MemoryBudget struct {
+	maxBytes  int64
+	used      atomic.Int64
+	evictions atomic.Int64
+
+	// mu 保护 caches，同时保证同一时刻只有一个 goroutine 在淘汰
+	mu     sync.Mutex
+	caches []*Cache
+}
+
+func NewMemoryBudget(maxBytes int64) *MemoryBudget {
+	return &MemoryBudget{maxBytes: maxBytes}
+}
+
+// WithMemoryBudget 让 Group 的缓存计入共享的 MemoryBudget。
+// 只有能主动淘汰数据的存储（默认的 lru 存储）会在超出上限时被回收，
+// 其他存储在创建时记录一条警告
+func WithMemoryBudget(b *MemoryBudget) GroupOption {
+	return func(g *Group) {
+		g.mainCache.budget = b
+		b.mu.Lock()
+		b.caches = append(b.caches, &g.mainCache)
+		b.mu.Unlock()
+	}
+}
+
+// Max 返回内存上限
+func (b *MemoryBudget) Max() int64 {
+	return b.maxBytes
+}
+
+// Used 返回所有 Group 已计入的字节数
+func (b *MemoryBudget) Used() int64 {
+	return b.used.Load()
+}
+
+// Evictions 返回因超出上限而淘汰的缓存项数量
+func (b *MemoryBudget) Evictions() int64 {
+	return b.evictions.Load()
+}
+
+// release 在 Group 被替换时移除其缓存，不再计入上限
+func (b *MemoryBudget) release(c *Cache) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, cc := range b.caches {
+		if cc == c {
+			b.caches = append(b.caches[:i], b.caches[i+1:]...)
+			b.used.Add(-c.used.Load())
+			return
+		}
+	}
+}
+
+func (b *MemoryBudget) enforce() {
+	if b.used.Load() <= b.maxBytes {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	skip := make(map[*Cache]bool)
+	for b.used.Load() > b.maxBytes {
+		var victim *Cache
+		for _, c := range b.caches {
+			if !skip[c] && c.used.Load() > 0 && (victim == nil || c.used.Load() > victim.used.Load()) {
+				victim = c
+			}
+		}
+		if victim == nil {
+			return
+		}
+		if !victim.evictOldest() {
+			skip[victim] = true
+			continue
+		}
+		b.evictions.Add(1)
+	}
+}
+
+// MemoryReport 对比各 Group 计入的字节数与运行时实际的堆内存
+type MemoryReport struct {
+	// Groups 为各 Group 缓存计入的字节数
+	Groups map[string]int64
+	// Accounted 为所有 Group 计入的字节数之和
+	Accounted int64
+	// HeapAlloc 与 HeapInuse 来自 runtime.MemStats，包括缓存之外的所有内存
+	HeapAlloc uint64
+	HeapInuse uint64
+}
+
+// MemoryReport 返回 Node 上所有 Group 的内存占用报告，会短暂地 stop the world
+func (n *Node) MemoryReport() MemoryReport {
+	r := MemoryReport{Groups: make(map[string]int64)}
+	n.mu.RLock()
+	for name, g := range n.groups {
+		used := g.mainCache.used.Load()
+		r.Groups[name] = used
+		r.Accounted += used
+	}
+	n.mu.RUnlock()
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	r.HeapAlloc = ms.HeapAlloc
+	r.HeapInuse = ms.HeapInuse
+	return r
+}
+
+// ReportMemory 返回默认 Node 的内存占用报告
+func ReportMemory() MemoryReport {
+	return defaultNode.MemoryReport()
+}
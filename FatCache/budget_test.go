@@ -0,0 +1,108 @@
+package fatcache
+
+import (
+	"fatcache/arena"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	plain := NewNode().NewGroup("plain", 1<<20, nil)
+	accounted := NewNode().NewGroup("accounted", 1<<20, nil, WithMemoryAccounting())
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		plain.Set(key, []byte("value"))
+		accounted.Set(key, []byte("value"))
+	}
+
+	if got := plain.Stats().CacheBytes; got != 10*(1+4+5) {
+		t.Fatalf("expected only key and value bytes without accounting, got %d", got)
+	}
+	want := 10 * (1 + 4 + 5 + lruEntryOverhead)
+	if got := accounted.Stats().CacheBytes; got != want {
+		t.Fatalf("expected per-entry overhead to be counted, got %d want %d", got, want)
+	}
+	if lruEntryOverhead < 64 {
+		t.Fatalf("per-entry overhead estimate looks too small: %d", lruEntryOverhead)
+	}
+
+	// 数据本身放得下但加上额外开销超出容量时，不能报告成功却不缓存
+	tight := NewNode().NewGroup("tight", 1+3+5+lruEntryOverhead-1, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value"), nil
+	}), WithMemoryAccounting())
+	if _, err := tight.Get("key"); err == nil {
+		t.Fatalf("expected error for a value that only fits without the entry overhead")
+	}
+	if err := tight.Set("key", []byte("value")); err == nil {
+		t.Fatalf("expected Set to report a value that cannot be cached")
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	node := NewNode()
+	budget := NewMemoryBudget(1000)
+	a := node.NewGroup("a", 1<<20, nil, WithMemoryBudget(budget))
+	b := node.NewGroup("b", 1<<20, nil, WithMemoryBudget(budget))
+	value := []byte(strings.Repeat("x", 96))
+
+	for i := 0; i < 8; i++ {
+		a.Set(fmt.Sprintf("a%d", i), value)
+	}
+	for i := 0; i < 4; i++ {
+		b.Set(fmt.Sprintf("b%d", i), value)
+		if budget.Used() > budget.Max() {
+			t.Fatalf("budget exceeded: %d > %d", budget.Used(), budget.Max())
+		}
+	}
+
+	// 超出上限时从占用最多的 a 中淘汰最旧的数据
+	if budget.Evictions() != 2 {
+		t.Fatalf("expected 2 evictions, got %d", budget.Evictions())
+	}
+	if _, ok := a.Peek("a0"); ok {
+		t.Fatalf("expected oldest entry of the largest group to be evicted")
+	}
+	if b.Stats().CacheItems != 4 {
+		t.Fatalf("expected smaller group to keep its entries, got %d", b.Stats().CacheItems)
+	}
+
+	report := node.MemoryReport()
+	if report.Accounted != budget.Used() || report.Groups["b"] != 4*(1+2+96) {
+		t.Fatalf("unexpected memory report %+v", report)
+	}
+	if report.HeapAlloc == 0 {
+		t.Fatalf("expected runtime heap usage in report")
+	}
+}
+
+func TestMemoryBudgetReplaceGroup(t *testing.T) {
+	budget := NewMemoryBudget(1 << 20)
+	g := NewGroup("budgetGroup", 1<<20, nil, WithMemoryBudget(budget))
+	g.Set("key", []byte("value"))
+	NewGroup("budgetGroup", 1<<20, nil, WithMemoryBudget(budget))
+	if budget.Used() != 0 {
+		t.Fatalf("expected replaced group to be released from the budget, got %d", budget.Used())
+	}
+}
+
+func TestMemoryBudgetUnsupportedStore(t *testing.T) {
+	logger := &recordLogger{}
+	budget := NewMemoryBudget(1 << 20)
+	group := NewNode().NewGroup("arenaBudget", 1<<20, nil, WithMemoryBudget(budget), WithLogger(logger),
+		WithStore(func(maxBytes int64, onEvict func(string, []byte)) Store {
+			return arena.New(maxBytes, onEvict)
+		}))
+	group.Set("a", []byte("1"))
+	group.Set("b", []byte("2"))
+
+	if len(logger.lines) != 1 || !strings.HasPrefix(logger.lines[0], "WARN store cannot evict on demand") {
+		t.Fatalf("expected one warning about the arena store, got %v", logger.lines)
+	}
+
+	plain := NewNode().NewGroup("lruBudget", 1<<20, nil, WithMemoryBudget(budget), WithLogger(logger))
+	plain.Set("a", []byte("1"))
+	if len(logger.lines) != 1 {
+		t.Fatalf("unexpected warning for the lru store: %v", logger.lines)
+	}
+}
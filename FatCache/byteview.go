@@ -9,11 +9,15 @@ func (bv ByteView) Len() int {
 }
 
 func (bv ByteView) ByteSlice() []byte {
-	copied := make([]byte, len(bv.b))
-	copy(copied, bv.b)
-	return copied
+	return cloneBytes(bv.b)
 }
 
 func (bv ByteView) String() string {
 	return string(bv.b)
 }
+
+func cloneBytes(b []byte) []byte {
+	copied := make([]byte, len(b))
+	copy(copied, b)
+	return copied
+}
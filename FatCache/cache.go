@@ -2,37 +2,356 @@ package fatcache
 
 import (
 	"fatcache/lru"
-	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// Store 是 Cache 的底层存储，实现需要在超出 maxBytes 时自行淘汰数据。
+// Cache 会对所有调用加锁，实现本身不需要并发安全
+type Store interface {
+	Add(key string, value []byte)
+	Get(key string) ([]byte, bool)
+	Remove(key string) bool
+	Len() int
+}
+
+// StoreFactory 创建容量为 maxBytes 的 Store，onEvict 应在数据被淘汰时调用
+type StoreFactory func(maxBytes int64, onEvict func(key string, value []byte)) Store
+
+// WithStore 替换 Group 默认的 lru 存储，例如使用 arena.New 减少 GC 压力
+func WithStore(f StoreFactory) GroupOption {
+	return func(g *Group) {
+		g.mainCache.newStore = f
+	}
+}
+
+// lruStore 把 lru.Cache 适配为 Store
+type lruStore struct {
+	lru *lru.Cache
+}
+
+func newLRUStore(maxBytes int64, onEvict func(key string, value []byte)) Store {
+	return &lruStore{lru: lru.New(maxBytes, func(key string, value lru.Value) {
+		onEvict(key, value.(ByteView).b)
+	})}
+}
+
+// lruStoreWithOverhead 返回每个缓存项额外计入 overhead 字节的 lru 存储
+func lruStoreWithOverhead(overhead int64) StoreFactory {
+	return func(maxBytes int64, onEvict func(key string, value []byte)) Store {
+		s := newLRUStore(maxBytes, onEvict).(*lruStore)
+		s.lru.SetEntryOverhead(overhead)
+		return s
+	}
+}
+
+func (s *lruStore) Add(key string, value []byte) {
+	s.lru.Add(key, ByteView{b: value})
+}
+
+func (s *lruStore) Get(key string) ([]byte, bool) {
+	if v, ok := s.lru.Get(key); ok {
+		return v.(ByteView).b, true
+	}
+	return nil, false
+}
+
+func (s *lruStore) Remove(key string) bool {
+	return s.lru.Remove(key)
+}
+
+func (s *lruStore) Len() int {
+	return s.lru.Len()
+}
+
+func (s *lruStore) KeysAfter(cursor lru.Cursor, n int) ([]string, lru.Cursor) {
+	return s.lru.KeysAfter(cursor, n)
+}
+
+func (s *lruStore) Bytes() int64 {
+	return s.lru.Bytes()
+}
+
+func (s *lruStore) RemoveOldest() bool {
+	if s.lru.Len() == 0 {
+		return false
+	}
+	s.lru.RemoveOldest()
+	return true
+}
+
+// sizedStore 是能报告已用字节数的 Store，Cache 据此统计内存占用
+type sizedStore interface {
+	Bytes() int64
+}
+
+// keyedStore 是能分批列出 key 的 Store，节点加入时其他节点据此提供预热的 key 列表。
+// KeysAfter 返回 cursor 之后最多 n 个 key 及下一批的游标，零值游标从头开始，返回少于 n 个时已列出全部
+type keyedStore interface {
+	KeysAfter(cursor lru.Cursor, n int) ([]string, lru.Cursor)
+}
+
+// evictableStore 是能主动淘汰最旧数据的 Store，MemoryBudget 只能从这类 Store 中回收内存
+type evictableStore interface {
+	RemoveOldest() bool
+}
+
 type Cache struct {
 	cacheBytes int64
-	lru        *lru.Cache
+	store      Store
+	newStore   StoreFactory
 	mu         sync.Mutex
+	// onEvict 在缓存项被淘汰后调用，调用时不持有 mu
+	onEvict func(key string, value ByteView)
+	evicted []*evictedEntry
+	// pending 为已淘汰、尚未交给 onEvict 的缓存项，key 被重新添加或 forget 时取消
+	pending map[string]*evictedEntry
+	// evictMu 使 onEvict 与 forget 中的 fn 互斥执行
+	evictMu sync.Mutex
+	// versions 记录 key 最近一次写入时的版本号，trackVersions 之后才维护
+	versions map[string]uint64
+	version  uint64
+
+	// overhead 为默认 lru 存储中每个缓存项额外计入的字节数
+	overhead int64
+	budget   *MemoryBudget
+	// used 为 store 已计入的字节数，可以不加锁读取
+	used atomic.Int64
+	// warn 用于报告 store 不支持 MemoryBudget，每个 Cache 只报告一次
+	warn   func(msg string)
+	warned bool
+}
+
+type evictedEntry struct {
+	key       string
+	value     ByteView
+	cancelled bool
 }
 
-func (c *Cache) add(key string, value ByteView) {
+// add 添加 key，返回 store 是否保留了它。store 可能因容量等原因丢弃数据，
+// 此时不会把它交给 onEvict
+func (c *Cache) add(key string, value ByteView) bool {
+	var warning string
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru != nil {
-		c.lru.Add(key, value)
-	} else {
-		c.lru = lru.New(c.cacheBytes, func(key string, value lru.Value) {
-			fmt.Println("onEvict", key)
+	if c.store == nil {
+		newStore := c.newStore
+		if newStore == nil {
+			newStore = lruStoreWithOverhead(c.overhead)
+		}
+		c.store = newStore(c.cacheBytes, func(key string, value []byte) {
+			delete(c.versions, key)
+			if c.onEvict != nil {
+				e := &evictedEntry{key: key, value: ByteView{b: value}}
+				c.evicted = append(c.evicted, e)
+				if c.pending == nil {
+					c.pending = make(map[string]*evictedEntry)
+				}
+				c.pending[key] = e
+			}
 		})
-		c.lru.Add(key, value)
+		warning = c.checkStore()
+	}
+	c.cancelEvicted(key)
+	if c.versions != nil {
+		c.version++
+		c.versions[key] = c.version
+	}
+	before := c.storeBytes()
+	c.store.Add(key, value.b)
+	_, kept := c.store.Get(key)
+	if !kept {
+		c.cancelEvicted(key)
+		delete(c.versions, key)
+	}
+	delta := c.storeBytes() - before
+	evicted := c.evicted
+	c.evicted = nil
+	c.mu.Unlock()
+
+	if warning != "" {
+		c.warn(warning)
+	}
+	c.deliver(evicted)
+	c.account(delta)
+	if c.budget != nil {
+		c.budget.enforce()
 	}
+	return kept
 }
 
 func (c *Cache) get(key string) (ByteView, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	if c.lru == nil {
+	if c.store == nil {
 		return ByteView{}, false
 	}
-	if value, ok := c.lru.Get(key); ok {
-		return value.(ByteView), ok
+	if value, ok := c.store.Get(key); ok {
+		return ByteView{b: value}, ok
 	}
 	return ByteView{}, false
 }
+
+// trackVersions 开始为之后写入的 key 记录版本号
+func (c *Cache) trackVersions() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.versions == nil {
+		c.versions = make(map[string]uint64)
+	}
+}
+
+// getVersion 与 get 相同，同时返回 key 的版本号。数据被替换后版本号改变，
+// trackVersions 之前写入且之后未变的数据版本号为 0
+func (c *Cache) getVersion(key string) (ByteView, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return ByteView{}, 0, false
+	}
+	if value, ok := c.store.Get(key); ok {
+		return ByteView{b: value}, c.versions[key], true
+	}
+	return ByteView{}, 0, false
+}
+
+func (c *Cache) remove(key string) bool {
+	c.mu.Lock()
+	if c.store == nil {
+		c.mu.Unlock()
+		return false
+	}
+	before := c.storeBytes()
+	ok := c.store.Remove(key)
+	delta := c.storeBytes() - before
+	delete(c.versions, key)
+	c.mu.Unlock()
+
+	c.account(delta)
+	return ok
+}
+
+// evictOldest 淘汰最旧的缓存项，store 不支持主动淘汰或为空时返回 false
+func (c *Cache) evictOldest() bool {
+	c.mu.Lock()
+	s, ok := c.store.(evictableStore)
+	if !ok {
+		c.mu.Unlock()
+		return false
+	}
+	before := c.storeBytes()
+	ok = s.RemoveOldest()
+	delta := c.storeBytes() - before
+	evicted := c.evicted
+	c.evicted = nil
+	c.mu.Unlock()
+
+	c.deliver(evicted)
+	c.account(delta)
+	return ok
+}
+
+// deliver 把淘汰的缓存项交给 onEvict，跳过已被取消的
+func (c *Cache) deliver(evicted []*evictedEntry) {
+	for _, e := range evicted {
+		c.evictMu.Lock()
+		c.mu.Lock()
+		cancelled := e.cancelled
+		if c.pending[e.key] == e {
+			delete(c.pending, e.key)
+		}
+		c.mu.Unlock()
+		if !cancelled {
+			c.onEvict(e.key, e.value)
+		}
+		c.evictMu.Unlock()
+	}
+}
+
+// forget 取消 key 尚未交给 onEvict 的淘汰数据，然后调用 fn。
+// fn 与 onEvict 互斥执行，fn 中对二级缓存的删除不会被之前淘汰的数据覆盖
+func (c *Cache) forget(key string, fn func()) {
+	c.evictMu.Lock()
+	defer c.evictMu.Unlock()
+	c.mu.Lock()
+	c.cancelEvicted(key)
+	c.mu.Unlock()
+	fn()
+}
+
+// cancelEvicted 取消 key 尚未交给 onEvict 的淘汰数据，调用时需持有 mu
+func (c *Cache) cancelEvicted(key string) {
+	if e, ok := c.pending[key]; ok {
+		e.cancelled = true
+		delete(c.pending, key)
+	}
+}
+
+// checkStore 在创建 store 后检查 MemoryBudget 能否计量和回收它，返回需要报告的警告，
+// 调用时需持有锁
+func (c *Cache) checkStore() string {
+	if c.budget == nil || c.warn == nil || c.warned {
+		return ""
+	}
+	_, sized := c.store.(sizedStore)
+	_, evictable := c.store.(evictableStore)
+	var msg string
+	switch {
+	case !sized:
+		msg = "store does not report its size, memory budget ignores this group"
+	case !evictable:
+		msg = "store cannot evict on demand, memory budget cannot reclaim this group"
+	}
+	c.warned = msg != ""
+	return msg
+}
+
+// storeBytes 返回 store 已用的字节数，调用时需持有锁
+func (c *Cache) storeBytes() int64 {
+	if s, ok := c.store.(sizedStore); ok {
+		return s.Bytes()
+	}
+	return 0
+}
+
+func (c *Cache) account(delta int64) {
+	if delta == 0 {
+		return
+	}
+	c.used.Add(delta)
+	if c.budget != nil {
+		c.budget.used.Add(delta)
+	}
+}
+
+// keysAfter 返回 cursor 之后最多 n 个 key 及下一批的游标，store 不支持列出 key 时返回 false
+func (c *Cache) keysAfter(cursor lru.Cursor, n int) ([]string, lru.Cursor, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return nil, cursor, true
+	}
+	s, ok := c.store.(keyedStore)
+	if !ok {
+		return nil, cursor, false
+	}
+	keys, next := s.KeysAfter(cursor, n)
+	return keys, next, true
+}
+
+func (c *Cache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.store == nil {
+		return 0
+	}
+	return c.store.Len()
+}
+
+// clear 丢弃所有缓存项，不触发 onEvict
+func (c *Cache) clear() {
+	c.mu.Lock()
+	delta := -c.storeBytes()
+	c.store = nil
+	c.mu.Unlock()
+	c.account(delta)
+}
@@ -0,0 +1,54 @@
+package fatcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec 负责 TypedGroup 中的值与缓存中 []byte 之间的转换
+type Codec[T any] interface {
+	Marshal(v T) ([]byte, error)
+	Unmarshal(b []byte) (T, error)
+}
+
+// JSONCodec 使用 encoding/json 编码
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Marshal(v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// GobCodec 使用 encoding/gob 编码，每个值单独编码，包含完整的类型信息
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Marshal(v T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// BytesCodec 原样保存 []byte
+type BytesCodec struct{}
+
+func (BytesCodec) Marshal(v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (BytesCodec) Unmarshal(b []byte) ([]byte, error) {
+	return b, nil
+}
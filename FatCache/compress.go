@@ -0,0 +1,105 @@
+package fatcache
+
+import (
+	"errors"
+	"fatcache/compression"
+)
+
+// valueCodec 在数据写入缓存前编码，读出时解码。
+// Group 按添加顺序依次编码，逆序解码，缓存和二级缓存中保存的都是编码后的数据
+type valueCodec interface {
+	encode(key string, b []byte) ([]byte, error)
+	decode(key string, b []byte) ([]byte, error)
+}
+
+const (
+	compressRaw byte = iota
+	compressed
+)
+
+var errBadCompressed = errors.New("fatcache: malformed compressed value")
+
+// defaultMaxValueSize 为解压后单个值的默认大小上限
+const defaultMaxValueSize = 64 << 20
+
+// compressCodec 在数据前加一个标记字节，压缩后没有变小的数据按原样保存，
+// 解压后超过 Group 的 MaxValueSize 的数据视为损坏
+type compressCodec struct {
+	c compression.Compressor
+	g *Group
+}
+
+func (cc compressCodec) encode(key string, b []byte) ([]byte, error) {
+	out, err := cc.c.Compress(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) >= len(b) {
+		return append([]byte{compressRaw}, b...), nil
+	}
+	return append([]byte{compressed}, out...), nil
+}
+
+func (cc compressCodec) decode(key string, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errBadCompressed
+	}
+	switch b[0] {
+	case compressRaw:
+		return b[1:], nil
+	case compressed:
+		return compression.DecompressLimit(cc.c, b[1:], cc.g.maxValueSize)
+	}
+	return nil, errBadCompressed
+}
+
+// WithCompression 让 Group 在缓存中保存压缩后的数据，缓存容量按压缩后的大小计算。
+// 节点间传输时，若对方在 Accept-Encoding 中声明支持同一算法，响应也会以压缩形式发送
+func WithCompression(c compression.Compressor) GroupOption {
+	return func(g *Group) {
+		g.compressor = c
+		// 压缩总是排在加密之前，密文无法再被压缩
+		g.codecs = append([]valueCodec{compressCodec{c: c, g: g}}, g.codecs...)
+	}
+}
+
+// WithMaxValueSize 设置单个值解压后的大小上限，默认为 64MB，
+// 同时作为从远端节点读取该 Group 的值时的上限
+func WithMaxValueSize(n int64) GroupOption {
+	return func(g *Group) {
+		g.maxValueSize = n
+	}
+}
+
+// storedCompressed 返回缓存中 key 以 g.compressor 压缩后的数据，可以直接作为响应发送。
+// 数据还经过加密等其他编码、未缓存或压缩后没有变小时返回 false
+func (g *Group) storedCompressed(key string) ([]byte, bool) {
+	if g.compressor == nil || len(g.codecs) != 1 {
+		return nil, false
+	}
+	value, ok := g.mainCache.get(g.cacheKey(key))
+	if !ok || len(value.b) == 0 || value.b[0] != compressed {
+		return nil, false
+	}
+	return value.b[1:], true
+}
+
+func (g *Group) encodeValue(key string, b []byte) ([]byte, error) {
+	var err error
+	for _, c := range g.codecs {
+		if b, err = c.encode(key, b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func (g *Group) decodeValue(key string, b []byte) ([]byte, error) {
+	var err error
+	for i := len(g.codecs) - 1; i >= 0; i-- {
+		if b, err = g.codecs[i].decode(key, b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,187 @@
+// Package compression 提供 fatcache 缓存值使用的压缩算法，
+// Name 同时作为节点间传输时的 Content-Encoding。
+//
+// 只使用标准库和本地实现：gzip 与 deflate 基于 compress/flate，
+// snappy 为本地实现的 snappy block 格式，压缩率较低但速度最快。
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Compressor interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// ErrTooLarge 表示解压后的数据超过了允许的大小
+var ErrTooLarge = errors.New("compression: decompressed size exceeds limit")
+
+// LimitedDecompressor 是能在解压过程中限制输出大小的 Compressor，内置算法均实现了该接口
+type LimitedDecompressor interface {
+	DecompressLimit(src []byte, limit int64) ([]byte, error)
+}
+
+// DecompressLimit 解压 src，结果超过 limit 字节时返回 ErrTooLarge，limit <= 0 表示不限制。
+// c 未实现 LimitedDecompressor 时先完整解压再检查大小，无法防止解压炸弹
+func DecompressLimit(c Compressor, src []byte, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return c.Decompress(src)
+	}
+	if lc, ok := c.(LimitedDecompressor); ok {
+		return lc.DecompressLimit(src, limit)
+	}
+	out, err := c.Decompress(src)
+	if err == nil && int64(len(out)) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, err
+}
+
+// readLimit 从 r 读取全部数据，超过 limit 字节时返回 ErrTooLarge
+func readLimit(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return io.ReadAll(r)
+	}
+	out, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err == nil && int64(len(out)) > limit {
+		return nil, ErrTooLarge
+	}
+	return out, err
+}
+
+var (
+	mu          sync.RWMutex
+	compressors = map[string]Compressor{}
+)
+
+// Register 注册 Compressor，使节点间传输可以按名称解码
+func Register(c Compressor) {
+	mu.Lock()
+	defer mu.Unlock()
+	compressors[c.Name()] = c
+}
+
+// Lookup 按名称查找已注册的 Compressor
+func Lookup(name string) (Compressor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := compressors[name]
+	return c, ok
+}
+
+// Names 返回所有已注册的 Compressor 名称，用于 Accept-Encoding
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(compressors))
+	for name := range compressors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Accepts 判断 Accept-Encoding 头是否接受 name
+func Accepts(acceptEncoding, name string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		token, _, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if token == name {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	Register(Gzip(gzip.DefaultCompression))
+	Register(Deflate(flate.BestSpeed))
+	Register(Snappy())
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+// Gzip 返回指定压缩级别的 gzip 压缩
+func Gzip(level int) Compressor {
+	return gzipCompressor{level: level}
+}
+
+func (gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c gzipCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c gzipCompressor) Decompress(src []byte) ([]byte, error) {
+	return c.DecompressLimit(src, 0)
+}
+
+func (gzipCompressor) DecompressLimit(src []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimit(r, limit)
+}
+
+type deflateCompressor struct {
+	level int
+}
+
+// Deflate 返回指定压缩级别的 raw deflate 压缩，没有 gzip 头部开销
+func Deflate(level int) Compressor {
+	return deflateCompressor{level: level}
+}
+
+func (deflateCompressor) Name() string {
+	return "deflate"
+}
+
+func (c deflateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, c.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c deflateCompressor) Decompress(src []byte) ([]byte, error) {
+	return c.DecompressLimit(src, 0)
+}
+
+func (deflateCompressor) DecompressLimit(src []byte, limit int64) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(src))
+	defer r.Close()
+	return readLimit(r, limit)
+}
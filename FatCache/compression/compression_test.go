@@ -0,0 +1,89 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func samples() [][]byte {
+	r := rand.New(rand.NewSource(1))
+	random := make([]byte, 5000)
+	r.Read(random)
+	var json strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&json, `{"id":%d,"name":"user%d","active":true,"tags":["a","b"]},`, i, i%7)
+	}
+	return [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("abcd"),
+		[]byte(strings.Repeat("a", 1000)),
+		[]byte(strings.Repeat("abcdefgh", 5000)),
+		[]byte(json.String()),
+		random,
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"gzip", "deflate", "x-snappy"} {
+		c, ok := Lookup(name)
+		if !ok {
+			t.Fatalf("compressor %s not registered", name)
+		}
+		for i, src := range samples() {
+			compressed, err := c.Compress(src)
+			if err != nil {
+				t.Fatalf("%s: compress sample %d: %v", name, i, err)
+			}
+			out, err := c.Decompress(compressed)
+			if err != nil {
+				t.Fatalf("%s: decompress sample %d: %v", name, i, err)
+			}
+			if !bytes.Equal(out, src) {
+				t.Fatalf("%s: sample %d did not round trip", name, i)
+			}
+		}
+	}
+}
+
+func TestSnappyCompresses(t *testing.T) {
+	src := samples()[5]
+	compressed, _ := Snappy().Compress(src)
+	if len(compressed)*3 > len(src) {
+		t.Fatalf("expected repetitive JSON to compress at least 3x, got %d -> %d", len(src), len(compressed))
+	}
+	if _, err := Snappy().Decompress(compressed[:len(compressed)/2]); err == nil {
+		t.Fatalf("expected truncated input to be rejected")
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	if !Accepts("deflate, x-snappy;q=0.5", "x-snappy") || Accepts("gzip", "x-snappy") {
+		t.Fatalf("unexpected Accept-Encoding matching")
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	src := bytes.Repeat([]byte{0}, 1<<20)
+	for _, name := range []string{"gzip", "deflate", "x-snappy"} {
+		c, _ := Lookup(name)
+		compressed, _ := c.Compress(src)
+		if _, err := DecompressLimit(c, compressed, 1<<10); err != ErrTooLarge {
+			t.Fatalf("%s: expected ErrTooLarge, got %v", name, err)
+		}
+		out, err := DecompressLimit(c, compressed, 1<<20)
+		if err != nil || len(out) != len(src) {
+			t.Fatalf("%s: expected value at the limit to decompress, got %d bytes, err %v", name, len(out), err)
+		}
+	}
+
+	// snappy 头部声明的长度超过限制时不分配内存
+	bomb := binary.AppendUvarint(nil, 1<<32)
+	if _, err := DecompressLimit(Snappy(), bomb, 1<<20); err != ErrTooLarge {
+		t.Fatalf("expected declared size to be checked, got %v", err)
+	}
+}
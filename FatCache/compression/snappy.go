@@ -0,0 +1,182 @@
+package compression
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// snappy block 格式：开头为 varint 编码的原始长度，之后是一系列元素，
+// 每个元素首字节的低 2 位为类型：
+//
+//	00 字面量，长度 - 1 存于高 6 位，>= 60 时由之后的 1~4 字节给出
+//	01 复制，长度 4~11，偏移 11 位
+//	10 复制，长度 1~64，偏移 2 字节
+//	11 复制，长度 1~64，偏移 4 字节
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+
+	snappyHashBits = 14
+	snappyMinMatch = 4
+)
+
+var ErrCorrupt = errors.New("compression: corrupt snappy input")
+
+type snappyCompressor struct{}
+
+// Snappy 返回本地实现的 snappy block 格式压缩
+func Snappy() Compressor {
+	return snappyCompressor{}
+}
+
+func (snappyCompressor) Name() string {
+	return "x-snappy"
+}
+
+func (snappyCompressor) Compress(src []byte) ([]byte, error) {
+	dst := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(src)+len(src)/6+16)
+	n := binary.PutUvarint(dst, uint64(len(src)))
+	dst = dst[:n]
+
+	var table [1 << snappyHashBits]int32
+	hash := func(u uint32) uint32 {
+		return (u * 0x1e35a7bd) >> (32 - snappyHashBits)
+	}
+
+	lit := 0 // 尚未输出的字面量起点
+	for i := 0; i+snappyMinMatch <= len(src); {
+		u := binary.LittleEndian.Uint32(src[i:])
+		h := hash(u)
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+		if cand < 0 || i-cand > 0xffff || binary.LittleEndian.Uint32(src[cand:]) != u {
+			i++
+			continue
+		}
+
+		dst = emitLiteral(dst, src[lit:i])
+		length := snappyMinMatch
+		for i+length < len(src) && src[cand+length] == src[i+length] {
+			length++
+		}
+		dst = emitCopy(dst, i-cand, length)
+		i += length
+		lit = i
+	}
+	dst = emitLiteral(dst, src[lit:])
+	return dst, nil
+}
+
+func emitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n<<2)|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+func emitCopy(dst []byte, offset, length int) []byte {
+	// 长度超过 64 时拆成多段，保证最后一段至少 4 字节
+	for length >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	if length >= 12 || offset >= 2048 {
+		return append(dst, byte(length-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+	}
+	return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|tagCopy1, byte(offset))
+}
+
+func (c snappyCompressor) Decompress(src []byte) ([]byte, error) {
+	return c.DecompressLimit(src, 0)
+}
+
+// DecompressLimit 在分配内存前检查头部声明的原始长度
+func (snappyCompressor) DecompressLimit(src []byte, limit int64) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > 1<<32 {
+		return nil, ErrCorrupt
+	}
+	if limit > 0 && size > uint64(limit) {
+		return nil, ErrTooLarge
+	}
+	dst := make([]byte, 0, size)
+	for s := n; s < len(src); {
+		tag := src[s]
+		var length, offset int
+		switch tag & 0x03 {
+		case tagLiteral:
+			length = int(tag >> 2)
+			s++
+			if length >= 60 {
+				extra := length - 59
+				if s+extra > len(src) {
+					return nil, ErrCorrupt
+				}
+				length = 0
+				for i := 0; i < extra; i++ {
+					length |= int(src[s+i]) << (8 * i)
+				}
+				s += extra
+			}
+			length++
+			if length > len(src)-s || len(dst)+length > int(size) {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[s:s+length]...)
+			s += length
+			continue
+		case tagCopy1:
+			if s+2 > len(src) {
+				return nil, ErrCorrupt
+			}
+			length = 4 + int(tag>>2)&0x07
+			offset = int(tag>>5)<<8 | int(src[s+1])
+			s += 2
+		case tagCopy2:
+			if s+3 > len(src) {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[s+1:]))
+			s += 3
+		case tagCopy4:
+			if s+5 > len(src) {
+				return nil, ErrCorrupt
+			}
+			length = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[s+1:]))
+			s += 5
+		}
+		if offset <= 0 || offset > len(dst) || len(dst)+length > int(size) {
+			return nil, ErrCorrupt
+		}
+		// 复制区域可能与输出重叠，需要逐字节复制
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	if len(dst) != int(size) {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
@@ -0,0 +1,164 @@
+package fatcache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// controlPrefix 是节点间控制请求的路径前缀，位于 basePath 之下，
+// 因此名为 _control 的 Group 无法通过 HTTP 访问
+const controlPrefix = "_control/"
+
+// serveControl 处理 basePath/_control/<op>/<group>[/<arg>] 形式的控制请求，调用前已完成节点认证。
+// 事件流 basePath/_control/events/ 不属于某个 Group
+func (h *HTTPPool) serveControl(w http.ResponseWriter, r *http.Request, path string) {
+	parts := strings.SplitN(path, "/", 3)
+	if parts[0] == "events" {
+		h.serveEvents(w, r)
+		return
+	}
+	if len(parts) < 2 {
+		http.Error(w, "bad control request", http.StatusBadRequest)
+		return
+	}
+	op, groupName := parts[0], parts[1]
+	group := h.node.GetGroup(groupName)
+	if group == nil {
+		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
+		return
+	}
+
+	switch op {
+	case "generation":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		gen, err := strconv.ParseUint(r.Header.Get(headerGeneration), 10, 64)
+		if err != nil {
+			http.Error(w, "bad generation", http.StatusBadRequest)
+			return
+		}
+		if !group.observeGeneration(gen) {
+			http.Error(w, "bad generation", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(headerGeneration, strconv.FormatUint(group.Generation(), 10))
+		w.WriteHeader(http.StatusNoContent)
+	case "keys":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		serveKeys(w, group)
+	case "invalidate-tag":
+		if r.Method != http.MethodPost || len(parts) != 3 {
+			http.Error(w, "bad control request", http.StatusBadRequest)
+			return
+		}
+		n := group.invalidateTagLocally(parts[2])
+		fmt.Fprint(w, n)
+	default:
+		http.Error(w, "unknown control operation: "+op, http.StatusNotFound)
+	}
+}
+
+// control 向远端节点发送控制请求，返回响应。
+// 超时覆盖读取响应的过程，调用方关闭响应 Body 时才释放超时的 ctx
+func (h *httpGetter) control(ctx context.Context, method, path string, header http.Header) (_ *http.Response, err error) {
+	cancel := context.CancelFunc(func() {})
+	if h.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+	}
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+	url := fmt.Sprintf("%s://%s%s%s%s", h.scheme, h.base, h.path, controlPrefix, path)
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if err := h.auth.sign(req); err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose 在 Body 关闭时释放请求的 ctx
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// SetGeneration 通知远端节点把 group 的代数跟进到 gen
+func (h *httpGetter) SetGeneration(ctx context.Context, group string, gen uint64) error {
+	header := http.Header{}
+	header.Set(headerGeneration, strconv.FormatUint(gen, 10))
+	resp, err := h.control(ctx, http.MethodPost, "generation/"+group, header)
+	if err != nil {
+		return fmt.Errorf("peer %s: %w", h.base, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// InvalidateTag 通知远端节点删除 group 中带有 tag 的数据
+func (h *httpGetter) InvalidateTag(ctx context.Context, group string, tag string) error {
+	resp, err := h.control(ctx, http.MethodPost, "invalidate-tag/"+group+"/"+url.PathEscape(tag), nil)
+	if err != nil {
+		return fmt.Errorf("peer %s: %w", h.base, err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+var (
+	_ GenerationPeer = (*httpGetter)(nil)
+	_ TagInvalidator = (*httpGetter)(nil)
+)
+
+// Peers 返回除自身以外的所有远端节点
+func (h *HTTPPool) Peers() []PeerGetter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.httpGetters))
+	for peer := range h.httpGetters {
+		if peer != h.self {
+			names = append(names, peer)
+		}
+	}
+	sort.Strings(names)
+	getters := make([]PeerGetter, len(names))
+	for i, name := range names {
+		getters[i] = h.httpGetters[name]
+	}
+	return getters
+}
+
+var _ PeerLister = (*HTTPPool)(nil)
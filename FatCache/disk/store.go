@@ -0,0 +1,440 @@
+// Package disk 实现一个追加写入的分段文件存储，作为 fatcache 内存缓存之后的二级缓存。
+//
+// 每条记录的格式为：
+//
+//	crc32(4) | keyLen(4) | valueLen(4) | key | value
+//
+// valueLen 为 tombstone 时表示删除。crc32 覆盖 crc 之后的全部内容，
+// 打开时遇到校验失败或不完整的记录，会把该段文件截断到最后一条完整记录处。
+package disk
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	headerSize = 12
+	tombstone  = ^uint32(0)
+
+	defaultSegmentSize = 64 << 20
+	segmentExt         = ".seg"
+)
+
+var ErrTooLarge = errors.New("disk: entry larger than segment size")
+
+type Options struct {
+	// Dir 为存放段文件的目录，不存在时自动创建
+	Dir string
+	// SegmentSize 单个段文件的大小上限，写满后切换到新段
+	SegmentSize int64
+	// MaxBytes 所有段文件的总大小上限，超出时删除最旧的段，0 表示不限制
+	MaxBytes int64
+}
+
+type location struct {
+	seg    uint32
+	offset int64
+	size   int64 // 整条记录的长度
+}
+
+type segment struct {
+	id   uint32
+	f    *os.File
+	size int64
+	dead int64 // 已被覆盖或删除的记录字节数
+}
+
+// Store 是带内存索引的分段追加存储，可以并发使用
+type Store struct {
+	mu       sync.RWMutex
+	opts     Options
+	index    map[string]location
+	segments []*segment // 按 id 升序，最后一个为当前写入段
+	onDrop   func(key string)
+}
+
+// OnDrop 设置存储自行丢弃 key 时的回调，包括删除最旧的段和丢弃损坏的记录，
+// 不包括 Delete。回调在持有锁时调用，不能再访问 Store
+func (s *Store) OnDrop(fn func(key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDrop = fn
+}
+
+func (s *Store) dropped(key string) {
+	if s.onDrop != nil {
+		s.onDrop(key)
+	}
+}
+
+// Open 打开 dir 下的存储，重建索引并修复损坏的段尾
+func Open(opts Options) (*Store, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = defaultSegmentSize
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Store{opts: opts, index: make(map[string]location)}
+
+	names, err := filepath.Glob(filepath.Join(opts.Dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, name := range names {
+		var id uint32
+		if _, err := fmt.Sscanf(filepath.Base(name), "%08d"+segmentExt, &id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		seg, err := s.openSegment(id)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+		if err := s.load(seg); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	if len(s.segments) == 0 {
+		if err := s.rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Store) segmentPath(id uint32) string {
+	return filepath.Join(s.opts.Dir, fmt.Sprintf("%08d%s", id, segmentExt))
+}
+
+func (s *Store) openSegment(id uint32) (*segment, error) {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &segment{id: id, f: f, size: info.Size()}, nil
+}
+
+// load 顺序扫描段文件重建索引，遇到损坏的记录时截断文件
+func (s *Store) load(seg *segment) error {
+	var offset int64
+	header := make([]byte, headerSize)
+	for offset < seg.size {
+		key, valueLen, size, err := readRecord(seg.f, offset, seg.size, header)
+		if err != nil {
+			// 段尾记录不完整或校验失败，丢弃之后的内容
+			if err := seg.f.Truncate(offset); err != nil {
+				return err
+			}
+			seg.size = offset
+			break
+		}
+		s.markDead(key)
+		if valueLen == tombstone {
+			seg.dead += size
+		} else {
+			s.index[key] = location{seg: seg.id, offset: offset, size: size}
+		}
+		offset += size
+	}
+	return nil
+}
+
+var errCorrupt = errors.New("disk: corrupt record")
+
+// readRecord 读取 offset 处的记录头和 key 并校验整条记录，fileSize 为段文件的大小
+func readRecord(f *os.File, offset, fileSize int64, header []byte) (string, uint32, int64, error) {
+	if _, err := f.ReadAt(header, offset); err != nil {
+		return "", 0, 0, errCorrupt
+	}
+	sum := binary.LittleEndian.Uint32(header[0:4])
+	keyLen := binary.LittleEndian.Uint32(header[4:8])
+	valueLen := binary.LittleEndian.Uint32(header[8:12])
+	bodyLen := int64(keyLen)
+	if valueLen != tombstone {
+		bodyLen += int64(valueLen)
+	}
+	// 记录头尚未校验，长度超出文件剩余部分时不分配内存，直接视为损坏
+	if bodyLen > fileSize-offset-headerSize {
+		return "", 0, 0, errCorrupt
+	}
+	body := make([]byte, bodyLen)
+	if _, err := f.ReadAt(body, offset+headerSize); err != nil {
+		return "", 0, 0, errCorrupt
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	if crc.Sum32() != sum {
+		return "", 0, 0, errCorrupt
+	}
+	return string(body[:keyLen]), valueLen, headerSize + bodyLen, nil
+}
+
+func encodeRecord(key string, value []byte, deleted bool) []byte {
+	valueLen := uint32(len(value))
+	if deleted {
+		valueLen = tombstone
+		value = nil
+	}
+	buf := make([]byte, headerSize+len(key)+len(value))
+	binary.LittleEndian.PutUint32(buf[4:8], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[8:12], valueLen)
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.LittleEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(buf[4:]))
+	return buf
+}
+
+// markDead 把 key 当前的记录计为无效数据
+func (s *Store) markDead(key string) {
+	if loc, ok := s.index[key]; ok {
+		if seg := s.segment(loc.seg); seg != nil {
+			seg.dead += loc.size
+		}
+		delete(s.index, key)
+	}
+}
+
+func (s *Store) segment(id uint32) *segment {
+	i := sort.Search(len(s.segments), func(i int) bool { return s.segments[i].id >= id })
+	if i < len(s.segments) && s.segments[i].id == id {
+		return s.segments[i]
+	}
+	return nil
+}
+
+func (s *Store) active() *segment {
+	return s.segments[len(s.segments)-1]
+}
+
+// rotate 创建新的写入段
+func (s *Store) rotate() error {
+	var id uint32 = 1
+	if len(s.segments) > 0 {
+		id = s.active().id + 1
+	}
+	seg, err := s.openSegment(id)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, seg)
+	return nil
+}
+
+// append 把记录写入当前段，必要时切换新段并淘汰最旧的段
+func (s *Store) append(record []byte) (location, error) {
+	return s.appendRecord(record, true)
+}
+
+func (s *Store) appendRecord(record []byte, enforce bool) (location, error) {
+	size := int64(len(record))
+	if size > s.opts.SegmentSize {
+		return location{}, ErrTooLarge
+	}
+	if s.active().size+size > s.opts.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return location{}, err
+		}
+		if enforce {
+			if err := s.enforceLimit(); err != nil {
+				return location{}, err
+			}
+		}
+	}
+	seg := s.active()
+	if _, err := seg.f.WriteAt(record, seg.size); err != nil {
+		return location{}, err
+	}
+	loc := location{seg: seg.id, offset: seg.size, size: size}
+	seg.size += size
+	return loc, nil
+}
+
+// enforceLimit 在总大小超过 MaxBytes 时删除最旧的段
+func (s *Store) enforceLimit() error {
+	if s.opts.MaxBytes <= 0 {
+		return nil
+	}
+	for len(s.segments) > 1 && s.bytes() > s.opts.MaxBytes {
+		if err := s.dropSegment(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) dropSegment(seg *segment) error {
+	for key, loc := range s.index {
+		if loc.seg == seg.id {
+			delete(s.index, key)
+			s.dropped(key)
+		}
+	}
+	for i, v := range s.segments {
+		if v == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	seg.f.Close()
+	return os.Remove(s.segmentPath(seg.id))
+}
+
+func (s *Store) bytes() int64 {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	return total
+}
+
+// Put 写入 key 的值，覆盖之前的值
+func (s *Store) Put(key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	loc, err := s.append(encodeRecord(key, value, false))
+	if err != nil {
+		return err
+	}
+	s.markDead(key)
+	s.index[key] = loc
+	return nil
+}
+
+// Get 读取 key 的值，读到损坏的记录时丢弃该 key
+func (s *Store) Get(key string) ([]byte, bool, error) {
+	// 读取期间持有读锁，避免段文件被 dropSegment 或 Compact 关闭
+	s.mu.RLock()
+	loc, ok := s.index[key]
+	seg := s.segment(loc.seg)
+	if !ok || seg == nil {
+		s.mu.RUnlock()
+		return nil, false, nil
+	}
+	buf := make([]byte, loc.size)
+	_, err := seg.f.ReadAt(buf, loc.offset)
+	s.mu.RUnlock()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, false, err
+	}
+	if k, ok := checkRecord(buf); !ok || k != key {
+		s.mu.Lock()
+		if cur, ok := s.index[key]; ok && cur == loc {
+			s.markDead(key)
+			s.dropped(key)
+		}
+		s.mu.Unlock()
+		return nil, false, errCorrupt
+	}
+	return buf[headerSize+len(key):], true, nil
+}
+
+// checkRecord 校验内存中的一条完整记录，返回其 key
+func checkRecord(buf []byte) (string, bool) {
+	if len(buf) < headerSize {
+		return "", false
+	}
+	keyLen := int(binary.LittleEndian.Uint32(buf[4:8]))
+	if headerSize+keyLen > len(buf) || crc32.ChecksumIEEE(buf[4:]) != binary.LittleEndian.Uint32(buf[0:4]) {
+		return "", false
+	}
+	return string(buf[headerSize : headerSize+keyLen]), true
+}
+
+// Delete 删除 key，key 不存在时不写入任何内容
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.index[key]; !ok {
+		return nil
+	}
+	loc, err := s.append(encodeRecord(key, nil, true))
+	if err != nil {
+		return err
+	}
+	s.markDead(key)
+	// tombstone 本身也是无效数据，只在重放时使用
+	s.active().dead += loc.size
+	return nil
+}
+
+// Compact 把旧段中仍然有效的记录重写到新段，并删除旧段
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old := append([]*segment(nil), s.segments...)
+	if err := s.rotate(); err != nil {
+		return err
+	}
+	for _, seg := range old {
+		for key, loc := range s.index {
+			if loc.seg != seg.id {
+				continue
+			}
+			record := make([]byte, loc.size)
+			if _, err := seg.f.ReadAt(record, loc.offset); err != nil {
+				return err
+			}
+			if k, ok := checkRecord(record); !ok || k != key {
+				delete(s.index, key)
+				s.dropped(key)
+				continue
+			}
+			// 压缩过程中不淘汰旧段，旧段在重写完成后统一删除
+			newLoc, err := s.appendRecord(record, false)
+			if err != nil {
+				return err
+			}
+			s.index[key] = newLoc
+		}
+		if err := s.dropSegment(seg); err != nil {
+			return err
+		}
+	}
+	return s.enforceLimit()
+}
+
+// Stats 返回存储中的 key 数量、总字节数和无效字节数
+func (s *Store) Stats() (keys int, bytes, dead int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, seg := range s.segments {
+		dead += seg.dead
+	}
+	return len(s.index), s.bytes(), dead
+}
+
+// Close 关闭所有段文件
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, seg := range s.segments {
+		if e := seg.f.Close(); e != nil && !errors.Is(e, os.ErrClosed) {
+			err = e
+		}
+	}
+	return err
+}
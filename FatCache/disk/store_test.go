@@ -0,0 +1,198 @@
+package disk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func mustGet(t *testing.T, s *Store, key string) string {
+	t.Helper()
+	v, ok, err := s.Get(key)
+	if err != nil || !ok {
+		t.Fatalf("expected %s to be present, got ok=%v err=%v", key, ok, err)
+	}
+	return string(v)
+}
+
+func TestPutGetDelete(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("a", []byte("1"))
+	s.Put("b", []byte("2"))
+	s.Put("a", []byte("3"))
+	s.Delete("b")
+
+	if v := mustGet(t, s, "a"); v != "3" {
+		t.Fatalf("expected overwritten value, got %s", v)
+	}
+	if _, ok, _ := s.Get("b"); ok {
+		t.Fatalf("expected b to be deleted")
+	}
+	s.Close()
+
+	// 重新打开后从段文件重建索引
+	s, err = Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v := mustGet(t, s, "a"); v != "3" {
+		t.Fatalf("expected value after reopen, got %s", v)
+	}
+	if _, ok, _ := s.Get("b"); ok {
+		t.Fatalf("expected tombstone to survive reopen")
+	}
+}
+
+func TestCorruptionRecovery(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(Options{Dir: dir})
+	s.Put("a", []byte("value-a"))
+	s.Put("b", []byte("value-b"))
+	s.Close()
+
+	// 破坏最后一条记录并追加半条记录
+	path := filepath.Join(dir, "00000001.seg")
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	data = append(data, 1, 2, 3)
+	os.WriteFile(path, data, 0o644)
+
+	s, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v := mustGet(t, s, "a"); v != "value-a" {
+		t.Fatalf("expected intact record to survive, got %s", v)
+	}
+	if _, ok, _ := s.Get("b"); ok {
+		t.Fatalf("expected corrupt record to be dropped")
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(headerSize+len("a")+len("value-a")) {
+		t.Fatalf("expected segment to be truncated after the last good record, size %d", info.Size())
+	}
+
+	s.Put("c", []byte("value-c"))
+	if v := mustGet(t, s, "c"); v != "value-c" {
+		t.Fatalf("expected writes after recovery to work, got %s", v)
+	}
+}
+
+func TestCorruptHeaderLength(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(Options{Dir: dir})
+	s.Put("a", []byte("value-a"))
+	s.Put("b", []byte("value-b"))
+	s.Close()
+
+	// 把第二条记录的 valueLen 改为接近 4GB，校验前不能按它分配内存
+	path := filepath.Join(dir, "00000001.seg")
+	data, _ := os.ReadFile(path)
+	second := headerSize + len("a") + len("value-a")
+	binary.LittleEndian.PutUint32(data[second+8:], 0xfffffff0)
+	os.WriteFile(path, data, 0o644)
+
+	s, err := Open(Options{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v := mustGet(t, s, "a"); v != "value-a" {
+		t.Fatalf("expected intact record to survive, got %s", v)
+	}
+	if info, _ := os.Stat(path); info.Size() != int64(second) {
+		t.Fatalf("expected segment to be truncated at the corrupt header, size %d", info.Size())
+	}
+}
+
+func TestConcurrentGetAndCompact(t *testing.T) {
+	s, _ := Open(Options{Dir: t.TempDir(), SegmentSize: 256})
+	defer s.Close()
+	for i := 0; i < 50; i++ {
+		s.Put(fmt.Sprintf("key%d", i), []byte("value"))
+	}
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, _, err := s.Get(fmt.Sprintf("key%d", j%50)); err != nil {
+					t.Errorf("Get during Compact: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		if err := s.Compact(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestMaxBytes(t *testing.T) {
+	s, _ := Open(Options{Dir: t.TempDir(), SegmentSize: 100, MaxBytes: 300})
+	defer s.Close()
+	dropped := map[string]bool{}
+	s.OnDrop(func(key string) { dropped[key] = true })
+	for i := 0; i < 50; i++ {
+		s.Put(fmt.Sprintf("key%02d", i), []byte("0123456789"))
+	}
+	_, bytes, _ := s.Stats()
+	if bytes > 300 {
+		t.Fatalf("expected store to stay within MaxBytes, got %d", bytes)
+	}
+	if _, ok, _ := s.Get("key00"); ok {
+		t.Fatalf("expected oldest entries to be dropped")
+	}
+	if !dropped["key00"] || dropped["key49"] {
+		t.Fatalf("expected drop callback for dropped keys only, got %v", dropped)
+	}
+	mustGet(t, s, "key49")
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := Open(Options{Dir: dir, SegmentSize: 100})
+	for i := 0; i < 20; i++ {
+		s.Put("hot", []byte(fmt.Sprintf("v%02d", i)))
+	}
+	s.Put("cold", []byte("c"))
+	s.Delete("gone")
+
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	keys, bytes, dead := s.Stats()
+	if keys != 2 || dead != 0 {
+		t.Fatalf("unexpected stats after compaction: keys=%d dead=%d", keys, dead)
+	}
+	if bytes > 100 {
+		t.Fatalf("expected compaction to reclaim space, got %d bytes", bytes)
+	}
+	s.Close()
+
+	s, _ = Open(Options{Dir: dir, SegmentSize: 100})
+	defer s.Close()
+	if v := mustGet(t, s, "hot"); v != "v19" {
+		t.Fatalf("expected latest value after compaction, got %s", v)
+	}
+	mustGet(t, s, "cold")
+}
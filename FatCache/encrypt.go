@@ -0,0 +1,124 @@
+package fatcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var errUnknownKey = errors.New("fatcache: value encrypted with unknown key")
+
+// Keyring 保存加密缓存数据使用的 AES 密钥。
+// 新数据使用当前密钥加密，轮换后旧密钥仍可解密之前写入的数据，直到被 Retire
+type Keyring struct {
+	mu      sync.RWMutex
+	current uint32
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewKeyring 创建以 id 为当前密钥的 Keyring，key 长度须为 16、24 或 32 字节
+func NewKeyring(id uint32, key []byte) (*Keyring, error) {
+	k := &Keyring{aeads: make(map[uint32]cipher.AEAD)}
+	if err := k.Rotate(id, key); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Add 添加只用于解密的密钥
+func (k *Keyring) Add(id uint32, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.aeads[id] = aead
+	return nil
+}
+
+// Rotate 添加密钥并把它设为当前密钥，之后写入的数据都使用它加密
+func (k *Keyring) Rotate(id uint32, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.aeads[id] = aead
+	k.current = id
+	return nil
+}
+
+// Retire 删除不再使用的密钥，用它加密的数据在读取时视为未命中。
+// 当前密钥不能被删除
+func (k *Keyring) Retire(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id == k.current {
+		return fmt.Errorf("cannot retire current key %d", id)
+	}
+	delete(k.aeads, id)
+	return nil
+}
+
+// Current 返回当前密钥的 ID
+func (k *Keyring) Current() uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptCodec 使用 AES-GCM 加密数据，格式为 keyID(4) | nonce | 密文，
+// 缓存的 key 作为附加数据，密文无法被挪到其他 key 下使用
+type encryptCodec struct {
+	keys *Keyring
+}
+
+func (ec encryptCodec) encode(key string, b []byte) ([]byte, error) {
+	ec.keys.mu.RLock()
+	id := ec.keys.current
+	aead := ec.keys.aeads[id]
+	ec.keys.mu.RUnlock()
+
+	out := make([]byte, 4+aead.NonceSize(), 4+aead.NonceSize()+len(b)+aead.Overhead())
+	binary.BigEndian.PutUint32(out, id)
+	if _, err := rand.Read(out[4:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, out[4:], b, []byte(key)), nil
+}
+
+func (ec encryptCodec) decode(key string, b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errUnknownKey
+	}
+	ec.keys.mu.RLock()
+	aead, ok := ec.keys.aeads[binary.BigEndian.Uint32(b)]
+	ec.keys.mu.RUnlock()
+	if !ok || len(b) < 4+aead.NonceSize() {
+		return nil, errUnknownKey
+	}
+	nonce := b[4 : 4+aead.NonceSize()]
+	return aead.Open(nil, nonce, b[4+aead.NonceSize():], []byte(key))
+}
+
+// WithEncryption 让 Group 在缓存和二级缓存中只保存加密后的数据，
+// 数据只在 Get 返回时解密。与 WithCompression 同时使用时总是先压缩再加密
+func WithEncryption(keys *Keyring) GroupOption {
+	return func(g *Group) {
+		g.codecs = append(g.codecs, encryptCodec{keys: keys})
+	}
+}
@@ -0,0 +1,76 @@
+package fatcache
+
+import (
+	"bytes"
+	"fatcache/compression"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	var loads int32
+	keys, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tier := mapTier{}
+	group := NewGroup("secretGroup", 1<<20, countingGetter(&loads),
+		WithEncryption(keys), WithCompression(compression.Snappy()), WithSecondTier(tier))
+
+	value, err := group.Get("alice")
+	if err != nil || value.String() != "local:alice" {
+		t.Fatalf("unexpected value %q, err %v", value.String(), err)
+	}
+	stored, _ := group.mainCache.get(group.cacheKey("alice"))
+	if bytes.Contains(stored.b, []byte("local:alice")) {
+		t.Fatalf("expected ciphertext in cache, found plaintext")
+	}
+
+	// 轮换后旧数据仍可读取，新数据使用新密钥
+	if err := keys.Rotate(2, bytes.Repeat([]byte{2}, 32)); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := group.Peek("alice"); !ok || value.String() != "local:alice" {
+		t.Fatalf("expected entry written with old key to decrypt after rotation")
+	}
+	group.Set("bob", []byte(strings.Repeat("pii ", 100)))
+	if value, ok := group.Peek("bob"); !ok || value.String() != strings.Repeat("pii ", 100) {
+		t.Fatalf("expected entry written with new key to round trip")
+	}
+
+	// 删除旧密钥后，旧数据视为未命中并重新加载
+	if err := keys.Retire(2); err == nil {
+		t.Fatalf("expected retiring the current key to fail")
+	}
+	keys.Retire(1)
+	if _, ok := group.Peek("alice"); ok {
+		t.Fatalf("expected entry encrypted with retired key to miss")
+	}
+	if _, err := group.Get("alice"); err != nil || loads != 2 {
+		t.Fatalf("expected reload after key retirement, loads=%d err=%v", loads, err)
+	}
+
+	// 淘汰到二级缓存的同样只有密文
+	small := NewGroup("secretTierGroup", 60, countingGetter(&loads), WithEncryption(keys), WithSecondTier(tier))
+	small.Get("key1")
+	small.Get("key2")
+	v, ok := tier[small.cacheKey("key1")]
+	if !ok || bytes.Contains(v, []byte("local:key1")) {
+		t.Fatalf("expected ciphertext in second tier, got %q", v)
+	}
+	if value, err := small.Get("key1"); err != nil || value.String() != "local:key1" {
+		t.Fatalf("expected second tier value to decrypt, got %q %v", value.String(), err)
+	}
+}
+
+func TestEncryptionBindsKey(t *testing.T) {
+	keys, _ := NewKeyring(1, bytes.Repeat([]byte{1}, 16))
+	codec := encryptCodec{keys: keys}
+	sealed, err := codec.encode("a", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.decode("b", sealed); err == nil {
+		t.Fatalf("expected ciphertext moved to another key to be rejected")
+	}
+}
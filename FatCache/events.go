@@ -0,0 +1,173 @@
+package fatcache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+// EventType 是节点间事件的类型
+type EventType uint8
+
+const (
+	// EventInvalidate 删除 key
+	EventInvalidate EventType = iota + 1
+	// EventSet 更新 key 的值，接收方只更新已缓存的副本
+	EventSet
+	// EventGeneration 跟进 Group 的代数
+	EventGeneration
+	// EventInvalidateTag 删除带有标签的数据
+	EventInvalidateTag
+	// EventResync 表示订阅方错过了部分事件，需要丢弃本地缓存
+	EventResync
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventInvalidate:
+		return "invalidate"
+	case EventSet:
+		return "set"
+	case EventGeneration:
+		return "generation"
+	case EventInvalidateTag:
+		return "invalidate-tag"
+	case EventResync:
+		return "resync"
+	}
+	return "unknown"
+}
+
+// Event 是一个节点发布给其他节点的变更，Seq 在发布节点内严格递增，
+// 订阅方按 Seq 顺序逐个应用，因此同一节点对同一 key 的变更保持顺序
+type Event struct {
+	Seq        uint64    `json:"seq"`
+	Type       EventType `json:"type"`
+	Group      string    `json:"group,omitempty"`
+	Key        string    `json:"key,omitempty"`
+	Value      []byte    `json:"value,omitempty"`
+	Tags       []string  `json:"tags,omitempty"`
+	Generation uint64    `json:"gen,omitempty"`
+}
+
+const defaultEventBacklog = 4096
+
+// eventLog 按序号保存最近发布的事件，供订阅方断线重连后补齐
+type eventLog struct {
+	mu    sync.Mutex
+	epoch string
+	// next 为下一个事件的序号，从 1 开始
+	next uint64
+	ring []Event
+	// notify 在有新事件时关闭并替换
+	notify chan struct{}
+}
+
+func newEventLog(backlog int) *eventLog {
+	if backlog <= 0 {
+		backlog = defaultEventBacklog
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return &eventLog{
+		epoch:  hex.EncodeToString(buf),
+		next:   1,
+		ring:   make([]Event, backlog),
+		notify: make(chan struct{}),
+	}
+}
+
+func (l *eventLog) publish(ev Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ev.Seq = l.next
+	l.ring[ev.Seq%uint64(len(l.ring))] = ev
+	l.next++
+	close(l.notify)
+	l.notify = make(chan struct{})
+}
+
+// last 返回最后一个已发布事件的序号
+func (l *eventLog) last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.next - 1
+}
+
+// read 返回序号大于 since 的事件，以及有新事件时会被关闭的 channel。
+// since 之后的部分事件已被覆盖时 ok 为 false，返回仍保留的全部事件
+func (l *eventLog) read(since uint64) (events []Event, notify <-chan struct{}, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	oldest := uint64(1)
+	if l.next > uint64(len(l.ring)) {
+		oldest = l.next - uint64(len(l.ring))
+	}
+	ok = true
+	if since+1 < oldest {
+		since, ok = oldest-1, false
+	}
+	for seq := since + 1; seq < l.next; seq++ {
+		events = append(events, l.ring[seq%uint64(len(l.ring))])
+	}
+	return events, l.notify, ok
+}
+
+// enableEvents 为 Node 开启事件发布，已有及之后创建的 Group 都会发布变更
+func (n *Node) enableEvents(backlog int) *eventLog {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.events == nil {
+		n.events = newEventLog(backlog)
+		for _, g := range n.groups {
+			g.events.Store(n.events)
+		}
+	}
+	return n.events
+}
+
+// applyEvent 在本节点应用远端节点发布的事件，不会再次发布
+func (n *Node) applyEvent(ev Event) {
+	if ev.Type == EventResync {
+		n.mu.RLock()
+		defer n.mu.RUnlock()
+		for _, g := range n.groups {
+			g.purgeLocally()
+		}
+		return
+	}
+	g := n.GetGroup(ev.Group)
+	if g == nil {
+		return
+	}
+	switch ev.Type {
+	case EventInvalidate:
+		g.removeLocally(ev.Key)
+	case EventSet:
+		ck := g.cacheKey(ev.Key)
+		if _, ok := g.mainCache.get(ck); ok {
+			g.populateCache(ck, ev.Value, ev.Tags)
+		}
+		g.removeFromSecondTier(ck)
+	case EventGeneration:
+		g.observeGeneration(ev.Generation)
+	case EventInvalidateTag:
+		for _, tag := range ev.Tags {
+			g.invalidateTagLocally(tag)
+		}
+	}
+}
+
+// publish 在开启事件时把变更发布给订阅了本节点的其他节点
+func (g *Group) publish(ev Event) {
+	if l := g.events.Load(); l != nil {
+		ev.Group = g.name
+		l.publish(ev)
+	}
+}
+
+// purgeLocally 清空本节点的内存缓存，二级缓存不受影响
+func (g *Group) purgeLocally() {
+	g.mainCache.clear()
+	g.tags.reset()
+}
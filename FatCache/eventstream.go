@@ -0,0 +1,287 @@
+package fatcache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	headerEpoch = "X-Fatcache-Epoch"
+	// headerSince 为事件流开始的位置，订阅方从这里开始计算已应用的序号
+	headerSince = "X-Fatcache-Since"
+
+	defaultEventHeartbeat   = 5 * time.Second
+	defaultEventBackoff     = 100 * time.Millisecond
+	maxEventBackoff         = 5 * time.Second
+	eventHeartbeatTolerance = 3
+)
+
+// EventOptions 配置节点间的事件通道。开启后每个节点与其他所有节点保持一条 HTTP 流，
+// 接收对方发布的 Set、Remove、代数和标签失效事件，使本节点缓存的副本及时更新
+type EventOptions struct {
+	// Backlog 为保留的最近事件数，订阅方断线期间错过的事件不超过它时可以补齐，默认 4096
+	Backlog int
+	// Heartbeat 为空闲时发送心跳的间隔，订阅方超过 3 个间隔没有收到数据时重连，默认 5s
+	Heartbeat time.Duration
+	// ReconnectBackoff 为断线后的初始重连间隔，之后加倍直到 5s，默认 100ms
+	ReconnectBackoff time.Duration
+}
+
+// EventStatus 是本节点对某个远端节点的订阅状态
+type EventStatus struct {
+	Connected bool
+	// LastSeq 为最后应用的事件序号
+	LastSeq uint64
+	Applied int64
+	// Resyncs 为因错过事件而丢弃本地缓存的次数
+	Resyncs    int64
+	Reconnects int64
+}
+
+// eventHub 管理 HTTPPool 对其他节点的订阅
+type eventHub struct {
+	opts   EventOptions
+	log    *eventLog
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	subs map[string]*eventSubscriber
+	wg   sync.WaitGroup
+}
+
+func newEventHub(node *Node, opts EventOptions) *eventHub {
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = defaultEventHeartbeat
+	}
+	if opts.ReconnectBackoff <= 0 {
+		opts.ReconnectBackoff = defaultEventBackoff
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &eventHub{
+		opts:   opts,
+		log:    node.enableEvents(opts.Backlog),
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[string]*eventSubscriber),
+	}
+}
+
+// subscribe 开始订阅 peer，已订阅时不做任何事
+func (e *eventHub) subscribe(pool *HTTPPool, peer string, getter *httpGetter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.subs[peer]; ok || e.ctx.Err() != nil {
+		return
+	}
+	s := &eventSubscriber{hub: e, node: pool.node, getter: getter}
+	e.subs[peer] = s
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		s.run(e.ctx)
+	}()
+}
+
+func (e *eventHub) close() {
+	e.cancel()
+	e.wg.Wait()
+}
+
+func (e *eventHub) status() map[string]EventStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := make(map[string]EventStatus, len(e.subs))
+	for peer, s := range e.subs {
+		status[peer] = EventStatus{
+			Connected:  s.connected.Load(),
+			LastSeq:    s.last.Load(),
+			Applied:    s.applied.Load(),
+			Resyncs:    s.resyncs.Load(),
+			Reconnects: s.reconnects.Load(),
+		}
+	}
+	return status
+}
+
+// serveEvents 以换行分隔的 JSON 持续发送本节点发布的事件。
+// 订阅方通过 since 和 epoch 说明已应用到的位置；首次订阅从当前位置开始，
+// 发布方重启或事件已被覆盖时先发送 EventResync
+func (h *HTTPPool) serveEvents(w http.ResponseWriter, r *http.Request) {
+	if h.events == nil {
+		http.Error(w, "events not enabled", http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	log := h.events.log
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	epoch := r.URL.Query().Get("epoch")
+	resync := false
+	switch {
+	case epoch == "":
+		since = log.last()
+	case epoch != log.epoch:
+		since, resync = 0, true
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set(headerEpoch, log.epoch)
+	w.Header().Set(headerSince, strconv.FormatUint(since, 10))
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	heartbeat := time.NewTicker(h.events.opts.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, notify, ok := log.read(since)
+		if !ok || resync {
+			resync = false
+			if err := enc.Encode(Event{Type: EventResync}); err != nil {
+				return
+			}
+		}
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return
+			}
+			since = ev.Seq
+		}
+		flusher.Flush()
+
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			if _, err := w.Write([]byte("\n")); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-h.events.ctx.Done():
+			return
+		}
+	}
+}
+
+// eventSubscriber 订阅一个远端节点的事件，断线后按退避间隔重连，并从最后应用的序号继续
+type eventSubscriber struct {
+	hub    *eventHub
+	node   *Node
+	getter *httpGetter
+	epoch  string
+
+	connected  atomic.Bool
+	last       atomic.Uint64
+	applied    atomic.Int64
+	resyncs    atomic.Int64
+	reconnects atomic.Int64
+}
+
+func (s *eventSubscriber) run(ctx context.Context) {
+	backoff := s.hub.opts.ReconnectBackoff
+	for {
+		received, err := s.stream(ctx)
+		s.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		s.getter.pool.logger.Log(LevelWarn, "event stream closed", F("peer", s.getter.base), F("err", err))
+		if received {
+			backoff = s.hub.opts.ReconnectBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxEventBackoff)
+		s.reconnects.Add(1)
+	}
+}
+
+// stream 建立一次订阅连接并持续应用事件，received 表示本次连接是否收到过事件
+func (s *eventSubscriber) stream(ctx context.Context) (received bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	h := s.getter
+	q := url.Values{}
+	q.Set("since", strconv.FormatUint(s.last.Load(), 10))
+	q.Set("epoch", s.epoch)
+	u := fmt.Sprintf("%s://%s%s%sevents/?%s", h.scheme, h.base, h.path, controlPrefix, q.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := h.auth.sign(req); err != nil {
+		return false, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	s.epoch = resp.Header.Get(headerEpoch)
+	if since, err := strconv.ParseUint(resp.Header.Get(headerSince), 10, 64); err == nil {
+		s.last.Store(since)
+	}
+	s.connected.Store(true)
+
+	// 超过若干个心跳间隔没有数据时认为连接已断开
+	watchdog := time.AfterFunc(eventHeartbeatTolerance*s.hub.opts.Heartbeat, cancel)
+	defer watchdog.Stop()
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return received, err
+		}
+		watchdog.Reset(eventHeartbeatTolerance * s.hub.opts.Heartbeat)
+		if len(line) <= 1 {
+			continue
+		}
+		var ev Event
+		if err := json.Unmarshal(line, &ev); err != nil {
+			return received, err
+		}
+		received = true
+		if ev.Type == EventResync {
+			s.resyncs.Add(1)
+		} else {
+			s.last.Store(ev.Seq)
+			s.applied.Add(1)
+		}
+		s.node.applyEvent(ev)
+	}
+}
+
+// EventStatus 返回本节点对各远端节点的事件订阅状态，未开启事件时返回 nil
+func (h *HTTPPool) EventStatus() map[string]EventStatus {
+	if h.events == nil {
+		return nil
+	}
+	return h.events.status()
+}
+
+// Close 停止事件订阅，并结束正在发送的事件流
+func (h *HTTPPool) Close() {
+	if h.events != nil {
+		h.events.close()
+	}
+}
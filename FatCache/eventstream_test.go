@@ -0,0 +1,163 @@
+package fatcache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cutHandler 可以切断正在进行的请求并拒绝新请求，模拟节点间网络中断
+type cutHandler struct {
+	h       http.Handler
+	blocked atomic.Bool
+
+	mu      sync.Mutex
+	cancels []context.CancelFunc
+}
+
+func (c *cutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.blocked.Load() {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	c.mu.Lock()
+	c.cancels = append(c.cancels, cancel)
+	c.mu.Unlock()
+	c.h.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (c *cutHandler) cut() {
+	c.blocked.Store(true)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cancel := range c.cancels {
+		cancel()
+	}
+	c.cancels = nil
+}
+
+type eventNode struct {
+	pool    *HTTPPool
+	group   *Group
+	handler *cutHandler
+}
+
+func startEventCluster(t *testing.T, n int, opts EventOptions) []*eventNode {
+	t.Helper()
+	servers := make([]*httptest.Server, n)
+	addrs := make([]string, n)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		addrs[i] = servers[i].Listener.Addr().String()
+	}
+	nodes := make([]*eventNode, n)
+	for i, server := range servers {
+		node := NewNode()
+		pool := node.NewHTTPPool(addrs[i], &HTTPPoolOptions{Events: &opts})
+		en := &eventNode{
+			pool:    pool,
+			group:   node.NewGroup("events", 1<<20, GetterFunc(func(key string) ([]byte, error) { return []byte("loaded"), nil })),
+			handler: &cutHandler{h: pool},
+		}
+		server.Config.Handler = en.handler
+		server.Start()
+		t.Cleanup(server.Close)
+		// 先停止订阅，server.Close 才不会等待事件流
+		t.Cleanup(pool.Close)
+		nodes[i] = en
+	}
+	for _, en := range nodes {
+		en.pool.Set(addrs...)
+	}
+	for _, en := range nodes {
+		waitFor(t, "subscriptions to connect", func() bool {
+			for _, s := range en.pool.EventStatus() {
+				if !s.Connected {
+					return false
+				}
+			}
+			return true
+		})
+	}
+	return nodes
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func peekString(g *Group, key string) string {
+	v, _ := g.Peek(key)
+	return v.String()
+}
+
+func TestEventBusPropagation(t *testing.T) {
+	nodes := startEventCluster(t, 3, EventOptions{})
+	a, b, c := nodes[0].group, nodes[1].group, nodes[2].group
+
+	b.Set("key", []byte("old"))
+	a.Set("key", []byte("new"))
+	waitFor(t, "set to reach the cached copy", func() bool { return peekString(b, "key") == "new" })
+	if _, ok := c.Peek("key"); ok {
+		t.Fatalf("set event must not populate nodes without a cached copy")
+	}
+
+	a.Remove("key")
+	waitFor(t, "remove to propagate", func() bool {
+		_, ok := b.Peek("key")
+		return !ok
+	})
+}
+
+func TestEventBusCatchUp(t *testing.T) {
+	nodes := startEventCluster(t, 2, EventOptions{ReconnectBackoff: 10 * time.Millisecond})
+	a, b := nodes[0], nodes[1]
+	b.group.Set("k1", []byte("old"))
+	b.group.Set("k2", []byte("old"))
+
+	a.handler.cut()
+	waitFor(t, "subscription to drop", func() bool { return !b.pool.EventStatus()[a.pool.self].Connected })
+	a.group.Set("k1", []byte("v1"))
+	a.group.Remove("k2")
+	a.handler.blocked.Store(false)
+
+	waitFor(t, "missed events to be replayed", func() bool {
+		_, ok := b.group.Peek("k2")
+		return peekString(b.group, "k1") == "v1" && !ok
+	})
+	status := b.pool.EventStatus()[a.pool.self]
+	if status.Reconnects == 0 || status.Resyncs != 0 {
+		t.Fatalf("expected reconnect without resync, got %+v", status)
+	}
+}
+
+func TestEventBusResync(t *testing.T) {
+	nodes := startEventCluster(t, 2, EventOptions{Backlog: 2, ReconnectBackoff: 10 * time.Millisecond})
+	a, b := nodes[0], nodes[1]
+	b.group.Set("unrelated", []byte("cached"))
+
+	a.handler.cut()
+	waitFor(t, "subscription to drop", func() bool { return !b.pool.EventStatus()[a.pool.self].Connected })
+	for _, key := range []string{"k1", "k2", "k3", "k4", "k5"} {
+		a.group.Set(key, []byte("v"))
+	}
+	a.handler.blocked.Store(false)
+
+	// 错过的事件超过保留数量，只能丢弃本地缓存
+	waitFor(t, "resync", func() bool { return b.pool.EventStatus()[a.pool.self].Resyncs == 1 })
+	if _, ok := b.group.Peek("unrelated"); ok {
+		t.Fatalf("expected local cache to be purged after resync")
+	}
+}
@@ -1,9 +1,12 @@
 package fatcache
 
 import (
+	"context"
+	"fatcache/compression"
 	"fatcache/singleflight"
 	"fmt"
-	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Getter interface {
@@ -17,102 +20,336 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
-)
+// ContextGetter 是能接收 ctx 的 Getter，Group 在本地加载时优先调用 GetContext。
+// ctx 来自发起加载的请求，同一 key 的并发请求共享第一个请求的 ctx
+type ContextGetter interface {
+	Getter
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
 
 type Group struct {
 	name      string
 	mainCache Cache
 	getter    Getter
-	peers     PeerPicker
-	loader    *singleflight.Group
+	// peers 为 RegisterPeerPicker 或 Node.RegisterPeers 设置的 PeerPicker，加载时可能被并发替换
+	peers      atomic.Pointer[PeerPicker]
+	loader     *singleflight.Group
+	peerPolicy PeerPolicy
+	secondTier SecondTier
+	compressor compression.Compressor
+	// maxValueSize 为解压后单个值的大小上限
+	maxValueSize int64
+	codecs       []valueCodec
+	gen          atomic.Uint64
+	tags         *tagIndex
+	events       atomic.Pointer[eventLog]
+	// setter 与 writeBehind 至多设置一个
+	setter       Setter
+	writeBehind  *writeBehind
+	batcher      *batchLoader
+	limiter      *loadLimiter
+	interceptors []Interceptor
+	tracer       Tracer
+	logger       Logger
+	hooks        Hooks
+	stats        groupStats
 }
 
+// GroupOption 用于在 NewGroup 时配置 Group 的可选行为
+type GroupOption func(*Group)
+
 func GetGroup(name string) *Group {
-	return groups[name]
+	return defaultNode.GetGroup(name)
 }
 
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-	mu.Lock()
-	defer mu.Unlock()
+// NewGroup 在默认 Node 上创建 Group，同名 Group 会被替换
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g, _ := defaultNode.addGroup(name, cacheBytes, getter, opts, true)
+	return g
+}
 
-	groups[name] = &Group{
+func newGroup(name string, cacheBytes int64, getter Getter, opts []GroupOption) *Group {
+	g := &Group{
 		name:      name,
 		mainCache: Cache{cacheBytes: cacheBytes},
 		getter:    getter,
 		loader:    &singleflight.Group{},
+		tags:      newTagIndex(),
+		logger:    defaultLogger,
+
+		maxValueSize: defaultMaxValueSize,
+	}
+	g.mainCache.onEvict = g.onEvicted
+	g.mainCache.warn = func(msg string) { g.log(LevelWarn, msg) }
+	for _, opt := range opts {
+		opt(g)
 	}
-	return groups[name]
+	return g
+}
 
+// Name 返回 Group 的名称
+func (g *Group) Name() string {
+	return g.name
 }
 
 func (g *Group) Get(key string) (ByteView, error) {
-	if value, ok := g.mainCache.get(key); ok {
-		fmt.Println("Cache hit")
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Get 相同，ctx 会传递给远端节点的请求
+func (g *Group) GetContext(ctx context.Context, key string) (_ ByteView, err error) {
+	g.stats.gets.Add(1)
+	ctx, span := g.startSpan(ctx, "fatcache.get", key)
+	defer func() { span.End(err) }()
+
+	ck := g.cacheKey(key)
+	_, lookup := g.startSpan(ctx, "fatcache.lookup", key)
+	value, ok := g.lookupCache(ck)
+	lookup.End(nil)
+	if ok {
+		g.recordHit(span, key)
 		return value, nil
 	}
-	fmt.Println("Cache miss - loading data")
+	span.SetAttribute("cache", "miss")
+	g.log(LevelDebug, "cache miss", F("key", key))
+	if g.hooks.OnMiss != nil {
+		g.hooks.OnMiss(g.name, key)
+	}
 
-	bytes, err := g.load(key)
+	// 加载结束前保留失效记录，epoch 由实际执行加载的请求取得，见 load
+	g.tags.begin()
+	defer g.tags.end()
+	res, err := g.load(ctx, key, ck)
 
 	if err != nil {
 		return ByteView{}, err
 	}
-	// 检查值大小
-	if int64(len(key))+int64(bytes.Len()) > g.mainCache.cacheBytes {
-		return ByteView{}, fmt.Errorf("value for key %s is too large to cache", key)
-	}
 	// 将数据添加到缓存
-	g.populateCache(key, bytes.ByteSlice())
+	_, populate := g.startSpan(ctx, "fatcache.populate", key)
+	err = g.populateLoaded(ck, res.value.ByteSlice(), res.tags, res.since)
+	populate.End(err)
+	if err != nil {
+		return ByteView{}, err
+	}
 
-	return ByteView{b: bytes.ByteSlice()}, nil
+	return ByteView{b: res.value.ByteSlice()}, nil
+}
+
+// recordHit 记录一次本节点内存缓存的命中
+func (g *Group) recordHit(span Span, key string) {
+	g.stats.cacheHits.Add(1)
+	span.SetAttribute("cache", "hit")
+	g.log(LevelDebug, "cache hit", F("key", key))
+	if g.hooks.OnHit != nil {
+		g.hooks.OnHit(g.name, key)
+	}
 }
 
 func (g *Group) RegisterPeerPicker(p PeerPicker) {
-	g.peers = p
+	g.peers.Store(&p)
+}
+
+// peerPicker 返回当前的 PeerPicker，未设置时返回 nil
+func (g *Group) peerPicker() PeerPicker {
+	if p := g.peers.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// loaded 是一次加载的结果及数据的标签，since 为加载开始时标签索引的 epoch
+type loaded struct {
+	value ByteView
+	tags  []string
+	since uint64
 }
 
-func (g *Group) load(key string) (ByteView, error) {
-	value, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				bytes, err := g.getFromPeer(peer, key)
+// load 加载 key 的数据，ck 为加入代数后的缓存 key
+func (g *Group) load(ctx context.Context, key, ck string) (_ loaded, err error) {
+	ctx, span := g.startSpan(ctx, "fatcache.load", key)
+	defer func() { span.End(err) }()
+	// 等待其他请求的加载结果时，span 的耗时即为 singleflight 的等待时间
+	leader := false
+	// 转发来的请求使用单独的 key：两个节点对环的看法不一致时，
+	// 若与本节点正在等待对方的加载合并，双方会互相等待
+	flightKey := ck
+	if isForwarded(ctx) {
+		flightKey = "fwd\x00" + ck
+	}
+	value, err := g.loader.Do(flightKey, func() (interface{}, error) {
+		leader = true
+		// 之后才加入等待的请求也按加载开始的时间判断标签是否被失效
+		since := g.tags.current()
+		if value, ok := g.getFromSecondTier(ck); ok {
+			return loaded{value, g.tags.tags(ck), since}, nil
+		}
+		// 写回队列中的值比后端存储新，在写入前被淘汰时从队列中读取
+		if g.writeBehind != nil {
+			if value, ok := g.writeBehind.lookup(key); ok {
+				return loaded{ByteView{b: value}, nil, since}, nil
+			}
+		}
+		// 其他节点转发来的请求总是在本地加载，避免节点列表不一致时来回转发
+		if peers := g.peerPicker(); peers != nil && !isForwarded(ctx) {
+			if peer, ok := peers.PickPeer(key); ok {
+				hint := &peerHint{sent: g.Generation()}
+				bytes, err := g.getFromPeers(withPeerHint(ctx, hint), peer, key)
+				g.observeGeneration(hint.seen.Load())
 				if err == nil {
-					return bytes, nil
+					g.stats.peerLoads.Add(1)
+					return loaded{bytes, hint.tagList(), since}, nil
+				}
+				g.stats.peerErrors.Add(1)
+				// 负责节点可用但 Getter 返回错误时，本地加载只会得到相同的结果
+				if !isPeerFailure(err) {
+					return loaded{}, err
 				}
 			}
 		}
-		return g.getLocally(key)
+		bytes, tags, err := g.getLocally(ctx, key)
+		return loaded{bytes, tags, since}, err
 	})
 
+	if !leader {
+		span.SetAttribute("singleflight", "shared")
+	}
 	if err == nil {
-		return value.(ByteView), nil
+		return value.(loaded), nil
 	}
-	return ByteView{}, fmt.Errorf("failed to load data for key %s: %v", key, err)
+	return loaded{}, fmt.Errorf("failed to load data for key %s: %w", key, err)
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
-	bytes, err := peer.Get(g.name, key)
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (_ ByteView, err error) {
+	ctx, span := g.startSpan(ctx, "fatcache.peer", key)
+	defer func() { span.End(err) }()
+	info := LoadInfo{Group: g.name, Key: key, Source: SourcePeer, Peer: peer}
+	start := time.Now()
+	bytes, err := g.intercept(ctx, info, func(ctx context.Context) ([]byte, error) {
+		if p, ok := peer.(ContextPeerGetter); ok {
+			return p.GetContext(ctx, g.name, key)
+		}
+		return peer.Get(g.name, key)
+	})
+	g.observeLoad(info, start, err)
 	if err == nil {
 		return ByteView{b: bytes}, nil
 	}
-	fmt.Println("Failed to get from peer:", err)
-	return ByteView{}, fmt.Errorf("no peer found for key %s", key)
+	return ByteView{}, fmt.Errorf("no peer found for key %s: %w", key, err)
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, []string, error) {
+	if g.limiter != nil {
+		release, err := g.limiter.acquire(ctx, key)
+		if err != nil {
+			return ByteView{}, nil, err
+		}
+		defer release()
+	}
 
-	bytes, err := g.getter.Get(key)
+	g.stats.localLoads.Add(1)
+	ctx, span := g.startSpan(ctx, "fatcache.getter", key)
+	var tags []string
+	info := LoadInfo{Group: g.name, Key: key, Source: SourceLocal}
+	start := time.Now()
+	bytes, err := g.intercept(ctx, info, func(ctx context.Context) ([]byte, error) {
+		if g.batcher != nil {
+			return g.batcher.load(ctx, key)
+		}
+		if tg, ok := g.getter.(TaggedGetter); ok {
+			var b []byte
+			var err error
+			b, tags, err = tg.GetTagged(key)
+			return b, err
+		}
+		if cg, ok := g.getter.(ContextGetter); ok {
+			return cg.GetContext(ctx, key)
+		}
+		return g.getter.Get(key)
+	})
+	span.End(err)
+	g.observeLoad(info, start, err)
 	if err == nil {
-		return ByteView{b: bytes}, nil
+		return ByteView{b: bytes}, tags, nil
+	}
+	g.stats.localLoadErrs.Add(1)
+
+	return ByteView{}, nil, fmt.Errorf("no locally found for key %s: %w", key, err)
+}
+
+// Peek 只查找本节点的缓存，不会触发加载
+func (g *Group) Peek(key string) (ByteView, bool) {
+	return g.lookupCache(g.cacheKey(key))
+}
+
+// lookupCache 查找本节点的缓存并解码，无法解码的数据会被删除，key 为加入代数后的缓存 key
+func (g *Group) lookupCache(key string) (ByteView, bool) {
+	value, ok := g.mainCache.get(key)
+	if !ok || len(g.codecs) == 0 {
+		return value, ok
+	}
+	b, err := g.decodeValue(key, value.b)
+	if err != nil {
+		g.log(LevelWarn, "failed to decode cached value", F("key", key), F("err", err))
+		g.mainCache.remove(key)
+		return ByteView{}, false
 	}
+	return ByteView{b: b}, true
+}
+
+// Set 直接把 value 写入本节点的缓存；开启事件时同时通知其他节点更新已缓存的副本。
+// 配置了 WithWriteThrough 或 WithWriteBehind 时同时写入后端存储
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetTagged(key, value)
+}
+
+// Remove 从本节点的缓存中删除 key，返回 key 是否在缓存中；开启事件时其他节点同时删除
+func (g *Group) Remove(key string) bool {
+	g.publish(Event{Type: EventInvalidate, Key: key})
+	return g.removeLocally(key)
+}
 
-	return ByteView{}, fmt.Errorf("no locally found for key %s", key)
+func (g *Group) removeLocally(key string) bool {
+	ck := g.cacheKey(key)
+	g.tags.remove(ck)
+	ok := g.mainCache.remove(ck)
+	g.removeFromSecondTier(ck)
+	return ok
 }
 
-// 将数据添加到缓存
-func (g *Group) populateCache(key string, bytes []byte) {
-	g.mainCache.add(key, ByteView{b: bytes})
+// populateLoaded 与 populateCache 相同，但加载开始后（since 之后）标签被失效的数据不写入缓存
+func (g *Group) populateLoaded(key string, bytes []byte, tags []string, since uint64) error {
+	if len(tags) == 0 {
+		return g.populateCache(key, bytes, nil)
+	}
+	if g.tags.stale(tags, since) {
+		return nil
+	}
+	if err := g.populateCache(key, bytes, tags); err != nil {
+		return err
+	}
+	// 写入期间标签被失效时撤回，InvalidateTag 可能在写入前已经删除过一次
+	if g.tags.stale(tags, since) {
+		g.tags.remove(key)
+		g.mainCache.remove(key)
+	}
+	return nil
+}
+
+// 将数据编码后添加到缓存，容量按编码后的大小计算，key 为加入代数后的缓存 key，
+// tags 替换 key 原有的标签
+func (g *Group) populateCache(key string, bytes []byte, tags []string) error {
+	bytes, err := g.encodeValue(key, bytes)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for key %s: %v", key, err)
+	}
+	// 默认的 lru 存储同样计入每项的额外开销，超出容量的数据会被立即淘汰
+	if int64(len(key))+int64(len(bytes))+g.mainCache.overhead > g.mainCache.cacheBytes {
+		return fmt.Errorf("value for key %s is too large to cache", key)
+	}
+	g.tags.set(key, tags)
+	if !g.mainCache.add(key, ByteView{b: bytes}) {
+		g.tags.remove(key)
+		return fmt.Errorf("value for key %s was not kept by the cache store", key)
+	}
+	return nil
 }
@@ -1,6 +1,10 @@
 package fatcache
 
 import (
+	"bytes"
+	"errors"
+	"fatcache/arena"
+	"fatcache/compression"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -8,6 +12,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type String string
@@ -67,12 +72,12 @@ func TestCacheEviction(t *testing.T) {
 	group.Get("key2") // 加载 "key2" + "Value for key2"
 
 	// "key1" 应该被淘汰
-	if _, ok := group.mainCache.get("key1"); ok {
+	if _, ok := group.mainCache.get(group.cacheKey("key1")); ok {
 		t.Fatalf("Expected key1 to be evicted")
 	}
 
 	// "key2" 应该仍在缓存中
-	if _, ok := group.mainCache.get("key2"); !ok {
+	if _, ok := group.mainCache.get(group.cacheKey("key2")); !ok {
 		t.Fatalf("Expected key2 to be in cache")
 	}
 }
@@ -208,3 +213,158 @@ func TestHTTPServer(t *testing.T) {
 		t.Fatalf("Expected status 400 for nonexistent key, got %d", resp.StatusCode)
 	}
 }
+
+type mapTier map[string][]byte
+
+func (m mapTier) Put(key string, value []byte) error { m[key] = value; return nil }
+func (m mapTier) Get(key string) ([]byte, bool, error) {
+	v, ok := m[key]
+	return v, ok, nil
+}
+func (m mapTier) Delete(key string) error { delete(m, key); return nil }
+
+func TestSecondTier(t *testing.T) {
+	var loads int32
+	tier := mapTier{}
+	group := NewGroup("tierGroup", 20, countingGetter(&loads), WithSecondTier(tier))
+
+	group.Get("key1")
+	group.Get("key2") // key1 被淘汰到二级缓存
+	if _, ok := tier[group.cacheKey("key1")]; !ok {
+		t.Fatalf("expected evicted key1 in second tier")
+	}
+
+	value, err := group.Get("key1")
+	if err != nil || value.String() != "local:key1" {
+		t.Fatalf("unexpected value %q, err %v", value.String(), err)
+	}
+	if loads != 2 || group.Stats().SecondTierHits != 1 {
+		t.Fatalf("expected key1 to be served from second tier, loads=%d", loads)
+	}
+
+	group.Remove("key2")
+	if _, ok := tier[group.cacheKey("key2")]; ok {
+		t.Fatalf("expected Remove to delete from second tier")
+	}
+}
+
+// blockingTier 的 Put 在 release 关闭前阻塞，entered 在 Put 开始时收到通知
+type blockingTier struct {
+	mu      sync.Mutex
+	data    map[string][]byte
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingTier) Put(key string, value []byte) error {
+	b.entered <- struct{}{}
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.data[key] = value
+	return nil
+}
+
+func (b *blockingTier) Get(key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	v, ok := b.data[key]
+	return v, ok, nil
+}
+
+func (b *blockingTier) Delete(key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.data, key)
+	return nil
+}
+
+func TestRemoveDuringTierPut(t *testing.T) {
+	var loads int32
+	tier := &blockingTier{data: map[string][]byte{}, entered: make(chan struct{}, 1), release: make(chan struct{})}
+	group := NewGroup("tierRaceGroup", 20, countingGetter(&loads), WithSecondTier(tier))
+	group.Get("key1")
+
+	done := make(chan struct{})
+	go func() {
+		group.Get("key2") // key1 被淘汰，写入二级缓存时阻塞
+		close(done)
+	}()
+	<-tier.entered
+	removed := make(chan struct{})
+	go func() {
+		group.Remove("key1")
+		close(removed)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(tier.release)
+	<-done
+	<-removed
+
+	// 淘汰之后的删除生效，二级缓存中不会留下旧值
+	if _, ok, _ := tier.Get(group.cacheKey("key1")); ok {
+		t.Fatalf("expected Remove to win over the eviction's second tier write")
+	}
+}
+
+func TestArenaStore(t *testing.T) {
+	var loads int32
+	group := NewGroup("arenaGroup", 1<<20, countingGetter(&loads),
+		WithStore(func(maxBytes int64, onEvict func(string, []byte)) Store {
+			return arena.New(maxBytes, onEvict)
+		}))
+
+	for i := 0; i < 2; i++ {
+		value, err := group.Get("key")
+		if err != nil || value.String() != "local:key" {
+			t.Fatalf("unexpected value %q, err %v", value.String(), err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected second Get to hit the arena store, got %d loads", loads)
+	}
+	if !group.Remove("key") {
+		t.Fatalf("expected key to be removed from the arena store")
+	}
+	// arena 丢弃过长的 key，Get 不能报告已缓存
+	if _, err := group.Get(strings.Repeat("k", 1<<16)); err == nil {
+		t.Fatalf("expected error when the store drops the entry")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	value := strings.Repeat("fatcache ", 1000)
+	// 压缩前 9000 字节，超过缓存容量，只有按压缩后的大小计算才能放入
+	group := NewGroup("compressGroup", 2048, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(value), nil
+	}), WithCompression(compression.Snappy()))
+
+	if err := group.Set("key", []byte(value)); err != nil {
+		t.Fatalf("expected compressed value to fit: %v", err)
+	}
+	got, ok := group.Peek("key")
+	if !ok || got.String() != value {
+		t.Fatalf("expected decompressed value from cache")
+	}
+	stored, _ := group.mainCache.get(group.cacheKey("key"))
+	if stored.Len() >= len(value)/4 {
+		t.Fatalf("expected compressed value in cache, got %d bytes", stored.Len())
+	}
+
+	// 缓存中的数据解压后不能超过 MaxValueSize
+	group.maxValueSize = 1 << 20
+	bomb, _ := compression.Snappy().Compress(make([]byte, 2<<20))
+	codec := compressCodec{c: compression.Snappy(), g: group}
+	if _, err := codec.decode("bomb", append([]byte{compressed}, bomb...)); !errors.Is(err, compression.ErrTooLarge) {
+		t.Fatalf("expected value larger than MaxValueSize to be rejected, got %v", err)
+	}
+
+	// 无法压缩的数据按原样保存
+	random := []byte{0x8f, 0x01, 0xee, 0x42}
+	if err := group.Set("random", random); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := group.Peek("random"); !bytes.Equal(got.ByteSlice(), random) {
+		t.Fatalf("unexpected value for incompressible data: %v", got.ByteSlice())
+	}
+}
@@ -0,0 +1,91 @@
+package fatcache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// headerGeneration 携带 Group 的代数，收到更大代数的一方会跟进
+const headerGeneration = "X-Fatcache-Generation"
+
+// maxGenerationJump 是一次跟进允许的最大增量，更大的跳变视为非法，
+// 也保证代数不会被推到 uint64 上限附近而回绕
+const maxGenerationJump = 1 << 20
+
+var errGenerationOverflow = errors.New("generation overflow")
+
+// Generation 返回 Group 当前的代数，初始为 0
+func (g *Group) Generation() uint64 {
+	return g.gen.Load()
+}
+
+// BumpGeneration 使 Group 的代数加一，之前缓存的所有数据立即不可见，并随 LRU 自然淘汰。
+// 新的代数会同步给实现了 GenerationPeer 的远端节点，同步失败的节点会在之后的请求中跟进
+func (g *Group) BumpGeneration(ctx context.Context) (uint64, error) {
+	var gen uint64
+	for {
+		cur := g.gen.Load()
+		if cur == math.MaxUint64 {
+			return cur, errGenerationOverflow
+		}
+		if g.gen.CompareAndSwap(cur, cur+1) {
+			gen = cur + 1
+			break
+		}
+	}
+	g.publish(Event{Type: EventGeneration, Generation: gen})
+	lister, ok := g.peerPicker().(PeerLister)
+	if !ok {
+		return gen, nil
+	}
+	var errs []error
+	for _, peer := range lister.Peers() {
+		if p, ok := peer.(GenerationPeer); ok {
+			if err := p.SetGeneration(ctx, g.name, gen); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return gen, fmt.Errorf("failed to propagate generation %d: %w", gen, errors.Join(errs...))
+	}
+	return gen, nil
+}
+
+// observeGeneration 在 gen 更大时跟进，代数不会回退；
+// 跳变超过 maxGenerationJump 时拒绝并返回 false
+func (g *Group) observeGeneration(gen uint64) bool {
+	for {
+		cur := g.gen.Load()
+		if gen <= cur {
+			return true
+		}
+		if gen-cur > maxGenerationJump {
+			g.log(LevelWarn, "rejected implausible generation jump", F("current", cur), F("observed", gen))
+			return false
+		}
+		if g.gen.CompareAndSwap(cur, gen) {
+			return true
+		}
+	}
+}
+
+// cacheKey 把代数以 uvarint 编码加在 key 前面作为缓存使用的 key。
+// 代数为 0 时同样带有前缀，uvarint 自身能确定长度，前缀不会与用户 key 的内容混淆
+func (g *Group) cacheKey(key string) string {
+	b := make([]byte, 0, binary.MaxVarintLen64+len(key))
+	b = binary.AppendUvarint(b, g.gen.Load())
+	return string(append(b, key...))
+}
+
+// userKey 去掉 cacheKey 加入的代数前缀
+func userKey(ck string) string {
+	_, n := binary.Uvarint([]byte(ck))
+	if n <= 0 {
+		return ck
+	}
+	return ck[n:]
+}
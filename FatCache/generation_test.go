@@ -0,0 +1,145 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestBumpGeneration(t *testing.T) {
+	var loads int32
+	group := NewGroup("genGroup", 1<<20, countingGetter(&loads))
+	group.Get("key")
+	group.Set("other", []byte("value"))
+
+	if gen, err := group.BumpGeneration(context.Background()); err != nil || gen != 1 {
+		t.Fatalf("expected generation 1, got %d err %v", gen, err)
+	}
+	if _, ok := group.Peek("other"); ok {
+		t.Fatalf("expected entries from the old generation to be unreachable")
+	}
+	group.Get("key")
+	group.Get("key")
+	if loads != 2 {
+		t.Fatalf("expected one reload after bump, got %d loads", loads)
+	}
+}
+
+func TestGenerationKeysUnambiguous(t *testing.T) {
+	group := NewGroup("genKeyGroup", 1<<20, nil)
+	group.Set("1\x00foo", []byte("gen0"))
+	if _, err := group.BumpGeneration(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// 旧代数中形似代数前缀的用户 key 不能在新代数中被读到
+	if v, ok := group.Peek("foo"); ok {
+		t.Fatalf("expected old user key not to collide with a new generation key, got %q", v.String())
+	}
+
+	group.Set("2\x00bar", []byte("v"))
+	var keys []string
+	group.cachedKeys(func(batch []string) error {
+		keys = append(keys, batch...)
+		return nil
+	})
+	if len(keys) != 1 || keys[0] != "2\x00bar" {
+		t.Fatalf("expected user key to be listed unchanged, got %q", keys)
+	}
+}
+
+func TestGenerationPropagation(t *testing.T) {
+	c := NewSimCluster(3, 1, "sim", 1<<20, simLoad)
+	for i := 0; i < 10; i++ {
+		c.Get(i%3, fmt.Sprintf("key%d", i))
+	}
+	if _, err := c.Nodes[0].Group.BumpGeneration(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range c.Nodes {
+		if n.Group.Generation() != 1 {
+			t.Fatalf("expected %s to follow generation 1, got %d", n.Name, n.Group.Generation())
+		}
+	}
+	for i := 0; i < 10; i++ {
+		c.Get(i%3, fmt.Sprintf("key%d", i))
+	}
+	if total := c.TotalLoads(); total != 20 {
+		t.Fatalf("expected every key to be reloaded once, got %d loads", total)
+	}
+}
+
+func TestGenerationCatchUp(t *testing.T) {
+	// 广播时不可达的节点在之后的请求中跟进
+	c := NewSimCluster(2, 1, "sim", 1<<20, simLoad)
+	c.Network.Partition([]string{"node0"}, []string{"node1"})
+	if _, err := c.Nodes[0].Group.BumpGeneration(context.Background()); err == nil {
+		t.Fatalf("expected propagation error across partition")
+	}
+	c.Network.Heal()
+
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("key%d", i); c.Owner(k).Name == "node1" {
+			key = k
+		}
+	}
+	if _, err := c.Get(0, key); err != nil {
+		t.Fatal(err)
+	}
+	if c.Nodes[1].Group.Generation() != 1 {
+		t.Fatalf("expected node1 to catch up from the forwarded request")
+	}
+}
+
+func TestHTTPGenerationPropagation(t *testing.T) {
+	nodes := startTestCluster(t, 3)
+	if _, err := nodes[1].group.BumpGeneration(context.Background()); err != nil {
+		t.Fatalf("Error propagating generation: %v", err)
+	}
+	for _, tn := range nodes {
+		if tn.group.Generation() != 1 {
+			t.Fatalf("expected %s to follow generation 1, got %d", tn.addr, tn.group.Generation())
+		}
+	}
+
+	// 远端节点在响应中带回更大的代数
+	nodes[2].group.observeGeneration(5)
+	for i := 0; nodes[0].group.Generation() != 5; i++ {
+		if i == 100 {
+			t.Fatalf("expected node 0 to learn generation 5 from responses")
+		}
+		nodes[0].group.Get(fmt.Sprintf("key%d", i))
+	}
+}
+
+func TestGenerationJumpRejected(t *testing.T) {
+	group := NewGroup("genJumpGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithLogger(NopLogger()))
+	if group.observeGeneration(math.MaxUint64) || group.Generation() != 0 {
+		t.Fatalf("expected max uint64 generation to be rejected, got %d", group.Generation())
+	}
+	if !group.observeGeneration(maxGenerationJump) || group.Generation() != maxGenerationJump {
+		t.Fatalf("expected generation within the jump limit to be accepted")
+	}
+
+	// 控制接口对非法跳变返回 400
+	pool := NewHTTPPool("self")
+	req := httptest.NewRequest(http.MethodPost, defaultBasePath+"_control/generation/genJumpGroup", nil)
+	req.Header.Set(headerGeneration, strconv.FormatUint(math.MaxUint64, 10))
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || group.Generation() != maxGenerationJump {
+		t.Fatalf("expected overflowing generation to be rejected, got %d gen %d", w.Code, group.Generation())
+	}
+
+	group.gen.Store(math.MaxUint64)
+	if _, err := group.BumpGeneration(context.Background()); !errors.Is(err, errGenerationOverflow) {
+		t.Fatalf("expected bump at max generation to fail, got %v", err)
+	}
+}
@@ -1,6 +1,6 @@
 module fatcache
 
-go 1.23.6
+go 1.24
 
 require github.com/stretchr/testify v1.10.0
 
@@ -1,61 +1,340 @@
 package fatcache
 
 import (
+	"context"
+	"errors"
+	"fatcache/compression"
 	"fatcache/consisitenthash"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-const defaultBasePath = "/_fatcache/"
+const (
+	defaultBasePath = "/_fatcache/"
+	defaultReplicas = 100
+)
+
+// HTTPPoolOptions 配置 HTTPPool 访问远端节点的方式，零值字段使用默认值
+type HTTPPoolOptions struct {
+	// BasePath 节点间通信的路径前缀，默认为 /_fatcache/
+	BasePath string
+	// Replicas 一致性哈希中每个节点的虚拟节点数
+	Replicas int
+
+	// Client 由调用方提供的 http.Client，设置后忽略 Transport 及连接池配置
+	Client *http.Client
+	// Transport 由调用方提供的 RoundTripper，设置后忽略连接池配置
+	Transport http.RoundTripper
+	// Timeout 单次远端请求的超时时间，0 表示不限制
+	Timeout time.Duration
+
+	// 连接池配置，仅在使用内置 Transport 时生效
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+
+	// EnableH2C 使用明文 HTTP/2 (h2c) 与远端节点通信，服务端需通过 NewServer 启动
+	EnableH2C bool
+
+	// Breaker 每个远端节点独立的熔断器配置
+	Breaker BreakerOptions
+
+	// TLS 开启后节点间使用 https 通信并双向校验证书，服务端需通过 NewServer 启动
+	TLS *MutualTLS
+	// Secret 非空时节点间请求使用 HMAC 签名，ReplayWindow 为允许的时间偏差
+	Secret       []byte
+	ReplayWindow time.Duration
+
+	// Events 不为 nil 时开启节点间的事件通道
+	Events *EventOptions
+
+	// MaxValueSize 为从远端节点读取的单个值在解压前后的大小上限，
+	// 默认为本节点同名 Group 的 WithMaxValueSize，Group 不存在时不限制
+	MaxValueSize int64
+
+	// Logger 为节点间通信的日志，默认只向标准错误输出警告和错误
+	Logger Logger
+
+	// Tracer 不为 nil 时为收到的每个请求记录 fatcache.serve span，父 span 取自 traceparent 请求头
+	Tracer Tracer
+}
 
 type httpGetter struct {
-	base string
+	scheme  string
+	base    string
+	path    string
+	client  *http.Client
+	timeout time.Duration
+	breaker *circuitBreaker
+	auth    *peerAuth
+	pool    *HTTPPool
+	// 最近一次响应中远端节点的哈希环版本
+	peerRing atomic.Value
+}
+
+func (h *httpGetter) Get(group string, key string) ([]byte, error) {
+	return h.GetContext(context.Background(), group, key)
 }
 
-func (h httpGetter) Get(group string, key string) ([]byte, error) {
-	// 构造请求 URL
+func (h *httpGetter) GetContext(ctx context.Context, group string, key string) ([]byte, error) {
+	if !h.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+	body, err := h.fetch(ctx, group, key)
+	switch {
+	case err == nil:
+		h.breaker.success()
+	case ctx.Err() != nil:
+		// 调用方主动取消（如对冲请求已由其他节点返回）不算节点故障
+		h.breaker.cancel()
+	case isPeerFailure(err):
+		h.breaker.failure()
+	default:
+		h.breaker.success()
+	}
+	return body, err
+}
 
-	url := fmt.Sprintf("http://%s%s%s/%s", h.base, defaultBasePath, group, key)
-	// 发起 GET 请求
-	fmt.Println("url:", url)
-	resp, err := http.Get(url)
+func (h *httpGetter) fetch(ctx context.Context, group string, key string) ([]byte, error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	// 构造请求 URL，group 和 key 分别转义，key 中的 "/"、"?" 等字符原样到达对端
+	u := fmt.Sprintf("%s://%s%s%s/%s", h.scheme, h.base, h.path, url.PathEscape(group), url.PathEscape(key))
+	h.pool.logger.Log(LevelDebug, "peer request", F("url", u))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(headerHop, "1")
+	req.Header.Set(headerRing, h.pool.RingVersion())
+	req.Header.Set("Accept-Encoding", strings.Join(compression.Names(), ", "))
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		req.Header.Set(headerTraceparent, sc.Traceparent())
+	}
+	hint := peerHintFrom(ctx)
+	if hint != nil {
+		req.Header.Set(headerGeneration, strconv.FormatUint(hint.sent, 10))
+	}
+	if err := h.auth.sign(req); err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if v := resp.Header.Get(headerRing); v != "" {
+		h.peerRing.Store(v)
+	}
+	if hint != nil {
+		if gen, err := strconv.ParseUint(resp.Header.Get(headerGeneration), 10, 64); err == nil {
+			hint.observe(gen)
+		}
+		if resp.StatusCode == http.StatusOK {
+			hint.setTags(decodeTags(resp.Header.Get(headerTags)))
+		}
+	}
 
 	// 检查 HTTP 响应状态码
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned: %v", resp.Status)
+		return nil, &statusError{code: resp.StatusCode, status: resp.Status}
 	}
 
-	// 读取响应体
-	body, err := io.ReadAll(resp.Body)
+	// 读取响应体，压缩前后的大小都不能超过上限
+	limit := h.pool.valueLimit(group)
+	var r io.Reader = resp.Body
+	if limit > 0 {
+		r = io.LimitReader(resp.Body, limit+1)
+	}
+	body, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("httpGetter body:", url)
+	if limit > 0 && int64(len(body)) > limit {
+		return nil, compression.ErrTooLarge
+	}
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		c, ok := compression.Lookup(enc)
+		if !ok {
+			return nil, fmt.Errorf("unsupported content encoding %q", enc)
+		}
+		if body, err = compression.DecompressLimit(c, body, limit); err != nil {
+			return nil, err
+		}
+	}
+	h.pool.logger.Log(LevelDebug, "peer response", F("url", u), F("bytes", len(body)))
 	return body, nil
 }
 
+var _ ContextPeerGetter = (*httpGetter)(nil)
+
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("server returned: %v", e.status)
+}
+
+// isPeerFailure 判断错误是否说明节点本身不可用，远端 Getter 返回的错误不计入熔断，也不重试
+func isPeerFailure(err error) bool {
+	var re *remoteError
+	if errors.As(err, &re) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code == http.StatusBadGateway ||
+			se.code == http.StatusServiceUnavailable ||
+			se.code == http.StatusGatewayTimeout
+	}
+	return true
+}
+
+// PeerStats 是单个远端节点的状态快照
+type PeerStats struct {
+	Breaker  string
+	Failures int
+	// RingVersion 为远端节点最近一次返回的哈希环版本，RingMismatch 表示与本节点不一致
+	RingVersion  string
+	RingMismatch bool
+}
+
 type HTTPPool struct {
+	node        *Node
 	self        string
 	mu          sync.Mutex
 	basePath    string
+	opts        HTTPPoolOptions
+	scheme      string
+	auth        *peerAuth
+	client      *http.Client
 	peers       *consisitenthash.Map
 	httpGetters map[string]*httpGetter
+	ring        string
+	// 收到的哈希环版本不一致的请求数
+	ringMismatches atomic.Int64
+	events         *eventHub
+	logger         Logger
 }
 
 func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolOpts(self, nil)
+}
+
+// NewHTTPPoolOpts 按 opts 创建服务于默认 Node 的 HTTPPool，opts 为 nil 时等价于 NewHTTPPool
+func NewHTTPPoolOpts(self string, opts *HTTPPoolOptions) *HTTPPool {
+	return newHTTPPool(defaultNode, self, opts)
+}
+
+func newHTTPPool(node *Node, self string, opts *HTTPPoolOptions) *HTTPPool {
+	h := &HTTPPool{
+		node:        node,
 		self:        self,
 		basePath:    defaultBasePath,
-		peers:       consisitenthash.New(100, nil),
 		httpGetters: make(map[string]*httpGetter, 0),
 	}
+	if opts != nil {
+		h.opts = *opts
+	}
+	if h.opts.BasePath != "" {
+		h.basePath = h.opts.BasePath
+	}
+	if h.opts.Replicas <= 0 {
+		h.opts.Replicas = defaultReplicas
+	}
+	h.scheme = "http"
+	if h.opts.TLS != nil {
+		h.scheme = "https"
+	}
+	h.logger = h.opts.Logger
+	if h.logger == nil {
+		h.logger = defaultLogger
+	}
+	h.auth = newPeerAuth(h.opts.Secret, h.opts.ReplayWindow)
+	h.peers = consisitenthash.New(h.opts.Replicas, nil)
+	h.client = newPeerClient(&h.opts)
+	if h.opts.Events != nil {
+		h.events = newEventHub(node, *h.opts.Events)
+	}
+	return h
+}
+
+// valueLimit 返回从远端节点读取 group 的值时的大小上限，0 表示不限制
+func (h *HTTPPool) valueLimit(group string) int64 {
+	if h.opts.MaxValueSize > 0 {
+		return h.opts.MaxValueSize
+	}
+	if g := h.node.GetGroup(group); g != nil {
+		return g.maxValueSize
+	}
+	return 0
+}
+
+// newPeerClient 根据配置构造访问远端节点的 http.Client
+func newPeerClient(opts *HTTPPoolOptions) *http.Client {
+	if opts.Client != nil {
+		return opts.Client
+	}
+	if opts.Transport != nil {
+		return &http.Client{Transport: opts.Transport}
+	}
+
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	if opts.MaxIdleConns > 0 {
+		t.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.TLS != nil {
+		t.TLSClientConfig = opts.TLS.ClientConfig()
+		t.ForceAttemptHTTP2 = true
+	} else if opts.EnableH2C {
+		// 节点间使用 prior knowledge 方式直接发起 h2c 连接
+		t.Protocols = new(http.Protocols)
+		t.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return &http.Client{Transport: t}
+}
+
+// NewServer 返回以 HTTPPool 作为 Handler 的 http.Server，开启 EnableH2C 时同时接受 h2c 连接，
+// 配置了 TLS 时需以 ListenAndServeTLS("", "") 启动
+func (h *HTTPPool) NewServer(addr string) *http.Server {
+	srv := &http.Server{Addr: addr, Handler: h}
+	if h.opts.TLS != nil {
+		srv.TLSConfig = h.opts.TLS.ServerConfig()
+	} else if h.opts.EnableH2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
+	return srv
 }
 
 func (h *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -65,33 +344,104 @@ func (h *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 解析 key 和 group
-	parts := strings.SplitN(r.URL.Path[len(h.basePath):], "/", 2)
+	// 校验节点身份
+	if h.opts.TLS != nil && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+		http.Error(w, "client certificate required", http.StatusForbidden)
+		return
+	}
+	if err := h.auth.verify(r); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.Path[len(h.basePath):]
+	if strings.HasPrefix(path, controlPrefix) {
+		h.serveControl(w, r, path[len(controlPrefix):])
+		return
+	}
+
+	// 解析 key 和 group：按转义后的路径切分再分别还原，key 中转义的 "/" 不会被当作分隔符
+	escaped := r.URL.EscapedPath()
+	if !strings.HasPrefix(escaped, h.basePath) {
+		http.Error(w, "unexpected path", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(escaped[len(h.basePath):], "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
+	groupName, err := url.PathUnescape(parts[0])
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	key, err := url.PathUnescape(parts[1])
+	if err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
 
-	groupName := parts[0]
-	key := parts[1]
+	ring := h.RingVersion()
+	if v := r.Header.Get(headerRing); v != "" && v != ring {
+		h.ringMismatches.Add(1)
+	}
+	w.Header().Set(headerRing, ring)
 
 	// 获取缓存组
-	group := GetGroup(groupName)
+	group := h.node.GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
 	}
 
-	// 获取缓存数据
-	value, err := group.Get(key)
+	// 跟进请求方更大的代数，并在响应中返回本节点的代数
+	if gen, err := strconv.ParseUint(r.Header.Get(headerGeneration), 10, 64); err == nil {
+		group.observeGeneration(gen)
+	}
+	w.Header().Set(headerGeneration, strconv.FormatUint(group.Generation(), 10))
+
+	// 获取缓存数据，已被转发过的请求只在本地加载
+	ctx := r.Context()
+	if r.Header.Get(headerHop) != "" {
+		ctx = withForwarded(ctx)
+	}
+	if sc, ok := ParseTraceparent(r.Header.Get(headerTraceparent)); ok {
+		ctx = ContextWithSpanContext(ctx, sc)
+	}
+	ctx, span := startSpan(ctx, h.opts.Tracer, "fatcache.serve")
+	span.SetAttribute("group", groupName)
+	span.SetAttribute("key", key)
+	value, err := group.GetContext(ctx, key)
+	span.End(err)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// 本节点过载时返回 503，请求方会把它当作节点不可用，换其他节点重试
+		code := http.StatusInternalServerError
+		if errors.Is(err, ErrOverloaded) {
+			code = http.StatusServiceUnavailable
+		}
+		http.Error(w, err.Error(), code)
 		return
 	}
 
-	// 返回缓存数据
+	// 返回缓存数据，对方支持 Group 的压缩算法时压缩后发送
+	if tags := group.Tags(key); len(tags) > 0 {
+		w.Header().Set(headerTags, encodeTags(tags))
+	}
+	body := value.ByteSlice()
 	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(value.ByteSlice())
+	w.Header().Set("Vary", "Accept-Encoding")
+	if c := group.compressor; c != nil && compression.Accepts(r.Header.Get("Accept-Encoding"), c.Name()) {
+		// 缓存中已是压缩后的数据时直接发送，不再解压后重新压缩
+		if stored, ok := group.storedCompressed(key); ok {
+			w.Header().Set("Content-Encoding", c.Name())
+			body = stored
+		} else if out, err := c.Compress(body); err == nil && len(out) < len(body) {
+			w.Header().Set("Content-Encoding", c.Name())
+			body = out
+		}
+	}
+	w.Write(body)
 }
 
 func (h *HTTPPool) Set(peers ...string) {
@@ -100,13 +450,56 @@ func (h *HTTPPool) Set(peers ...string) {
 	h.peers.Add(peers...)
 
 	for _, peer := range peers {
-		h.httpGetters[peer] = &httpGetter{
-			base: peer,
+		getter := &httpGetter{
+			scheme:  h.scheme,
+			base:    peer,
+			path:    h.basePath,
+			client:  h.client,
+			timeout: h.opts.Timeout,
+			breaker: newCircuitBreaker(h.opts.Breaker),
+			auth:    h.auth,
+			pool:    h,
+		}
+		h.httpGetters[peer] = getter
+		if h.events != nil && peer != h.self {
+			h.events.subscribe(h, peer, getter)
 		}
 	}
+
+	members := make([]string, 0, len(h.httpGetters))
+	for peer := range h.httpGetters {
+		members = append(members, peer)
+	}
+	h.ring = ringVersion(members)
+}
+
+// RingVersion 返回本节点当前哈希环的版本
+func (h *HTTPPool) RingVersion() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.ring
+}
+
+// RingStatus 返回本节点与其他节点的哈希环版本对比情况
+func (h *HTTPPool) RingStatus() RingStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := RingStatus{
+		Version:            h.ring,
+		Mismatched:         make(map[string]string),
+		MismatchedRequests: h.ringMismatches.Load(),
+	}
+	for peer, getter := range h.httpGetters {
+		if v, _ := getter.peerRing.Load().(string); v != "" && v != h.ring {
+			status.Mismatched[peer] = v
+		}
+	}
+	return status
 }
 
 func (h *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	peer := h.peers.Get(key)
 
 	// 如果选中的节点是自身，直接返回 nil
@@ -115,8 +508,48 @@ func (h *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	}
 
 	if v, ok := h.httpGetters[peer]; ok {
-		fmt.Println("Pick peer", peer)
+		h.logger.Log(LevelDebug, "pick peer", F("key", key), F("peer", peer))
 		return v, true
 	}
 	return nil, false
 }
+
+// PickPeers 按环上顺序返回负责 key 的前 n 个远端节点，跳过自身
+func (h *HTTPPool) PickPeers(key string, n int) []PeerGetter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var getters []PeerGetter
+	// 多取一个，保证跳过自身后仍有 n 个
+	for _, peer := range h.peers.GetN(key, n+1) {
+		if peer == h.self {
+			continue
+		}
+		if v, ok := h.httpGetters[peer]; ok && len(getters) < n {
+			getters = append(getters, v)
+		}
+	}
+	return getters
+}
+
+// PeerStats 返回每个远端节点的熔断器状态
+func (h *HTTPPool) PeerStats() map[string]PeerStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := make(map[string]PeerStats, len(h.httpGetters))
+	for peer, getter := range h.httpGetters {
+		state, failures := getter.breaker.snapshot()
+		ring, _ := getter.peerRing.Load().(string)
+		stats[peer] = PeerStats{
+			Breaker:      state.String(),
+			Failures:     failures,
+			RingVersion:  ring,
+			RingMismatch: ring != "" && ring != h.ring,
+		}
+	}
+	return stats
+}
+
+var (
+	_ PeerListPicker = (*HTTPPool)(nil)
+	_ peerStatser    = (*HTTPPool)(nil)
+)
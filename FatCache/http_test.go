@@ -0,0 +1,322 @@
+package fatcache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fatcache/compression"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingTransport struct {
+	n int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.n, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHTTPGetterTimeout(t *testing.T) {
+	block := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-block:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(block)
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{Timeout: 50 * time.Millisecond})
+	pool.Set(addr)
+	peer, ok := pool.PickPeer("key")
+	if !ok {
+		t.Fatalf("expected remote peer to be picked")
+	}
+
+	start := time.Now()
+	if _, err := peer.Get("testGroup", "key"); err == nil {
+		t.Fatalf("expected timeout error from hung peer")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("request was not cancelled in time: %v", elapsed)
+	}
+}
+
+func TestHTTPPoolCustomTransport(t *testing.T) {
+	NewGroup("transportGroup", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("Value for " + key), nil
+	}))
+	server := httptest.NewServer(NewHTTPPool("remote"))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{Transport: transport})
+	pool.Set(strings.TrimPrefix(server.URL, "http://"))
+	peer, _ := pool.PickPeer("key")
+
+	value, err := peer.Get("transportGroup", "key")
+	if err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if string(value) != "Value for key" {
+		t.Fatalf("Unexpected value, got %s", value)
+	}
+	if atomic.LoadInt32(&transport.n) != 1 {
+		t.Fatalf("expected custom transport to be used, got %d round trips", transport.n)
+	}
+}
+
+func TestHTTPPoolH2C(t *testing.T) {
+	NewGroup("h2cGroup", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("Value for " + key), nil
+	}))
+	remote := NewHTTPPoolOpts("remote", &HTTPPoolOptions{EnableH2C: true})
+
+	var proto int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.StoreInt32(&proto, int32(r.ProtoMajor))
+		remote.ServeHTTP(w, r)
+	}))
+	server.Config.Protocols = remote.NewServer("").Protocols
+	server.Start()
+	defer server.Close()
+
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{EnableH2C: true})
+	pool.Set(strings.TrimPrefix(server.URL, "http://"))
+	peer, _ := pool.PickPeer("key")
+	if _, err := peer.Get("h2cGroup", "key"); err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if atomic.LoadInt32(&proto) != 2 {
+		t.Fatalf("expected HTTP/2 request, got HTTP/%d", proto)
+	}
+}
+
+func TestForwardingLoopProtection(t *testing.T) {
+	var loads int32
+	// 本节点认为 key 属于 peer，普通请求会被转发
+	peer := &fakePeer{name: "peer"}
+	group := NewGroup("loopGroup", 1024, countingGetter(&loads))
+	group.RegisterPeerPicker(&fakePicker{peers: []PeerGetter{peer}})
+
+	pool := NewHTTPPool("B")
+	pool.Set("B", "C")
+	req := httptest.NewRequest(http.MethodGet, defaultBasePath+"loopGroup/key", nil)
+	req.Header.Set(headerHop, "1")
+	req.Header.Set(headerRing, "other")
+	w := httptest.NewRecorder()
+	pool.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "local:key" {
+		t.Fatalf("expected forwarded request to be served locally, got %d %s", w.Code, w.Body.String())
+	}
+	if atomic.LoadInt32(&peer.calls) != 0 || atomic.LoadInt32(&loads) != 1 {
+		t.Fatalf("forwarded request must not be forwarded again")
+	}
+	if w.Header().Get(headerRing) != pool.RingVersion() {
+		t.Fatalf("expected ring version in response header")
+	}
+	if status := pool.RingStatus(); status.MismatchedRequests != 1 {
+		t.Fatalf("expected one mismatched request, got %+v", status)
+	}
+}
+
+func TestForwardedLoadWithDisagreeingRings(t *testing.T) {
+	// A 认为 key 属于 B，B 只知道 A，认为 key 属于 A；两个节点同时加载 key，
+	// 转发来的请求不能与本节点正在等待对方的加载合并
+	var arrived atomic.Int32
+	release := make(chan struct{})
+	type ringNode struct {
+		node   *Node
+		pool   *HTTPPool
+		group  *Group
+		server *httptest.Server
+		addr   string
+	}
+	nodes := make([]*ringNode, 2)
+	for i := range nodes {
+		rn := &ringNode{node: NewNode()}
+		rn.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			arrived.Add(1)
+			<-release
+			rn.pool.ServeHTTP(w, r)
+		}))
+		rn.addr = rn.server.Listener.Addr().String()
+		nodes[i] = rn
+	}
+	a, b := nodes[0], nodes[1]
+	for _, rn := range nodes {
+		rn.pool = rn.node.NewHTTPPool(rn.addr, nil)
+		addr := rn.addr
+		rn.group = rn.node.NewGroup("ring", 1024, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(addr), nil
+		}))
+		rn.server.Start()
+		defer rn.server.Close()
+	}
+	a.pool.Set(a.addr, b.addr)
+	b.pool.Set(a.addr)
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if _, ok := a.pool.PickPeer(key); ok {
+			break
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	start := time.Now()
+	errs := make(chan error, 2)
+	for _, rn := range nodes {
+		go func(g *Group) {
+			_, err := g.GetContext(ctx, key)
+			errs <- err
+		}(rn.group)
+	}
+	// 两个节点的加载都已发出请求后再处理转发来的请求
+	waitFor(t, "both loads to reach the other node", func() bool { return arrived.Load() == 2 })
+	close(release)
+	for range nodes {
+		if err := <-errs; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("loads with disagreeing rings deadlocked until the deadline (%v)", elapsed)
+	}
+}
+
+func TestHTTPKeyEscaping(t *testing.T) {
+	nodes := startTestCluster(t, 3)
+	// 含有路径分隔符、查询和转义字符的 key 原样到达负责节点
+	for _, base := range []string{"a/b", "c?d=e", "f%2Fg", "h i#j"} {
+		key := base
+		for i := 0; ; i++ {
+			if _, remote := nodes[0].pool.PickPeer(key); remote {
+				break
+			}
+			key = fmt.Sprintf("%s/%d", base, i)
+		}
+		value, err := nodes[0].group.Get(key)
+		if err != nil {
+			t.Fatalf("%q: %v", key, err)
+		}
+		if !strings.HasSuffix(value.String(), ":"+key) || strings.HasPrefix(value.String(), nodes[0].addr) {
+			t.Fatalf("%q: expected value loaded by the owner, got %q", key, value.String())
+		}
+	}
+}
+
+func TestRingVersionMismatch(t *testing.T) {
+	NewGroup("ringGroup", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("Value for " + key), nil
+	}))
+	remote := NewHTTPPool("B")
+	remote.Set("B", "C")
+	server := httptest.NewServer(remote)
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	pool := NewHTTPPool("A")
+	pool.Set(addr)
+	peer, _ := pool.PickPeer("key")
+	if _, err := peer.Get("ringGroup", "key"); err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+
+	if status := pool.RingStatus(); status.Mismatched[addr] != remote.RingVersion() {
+		t.Fatalf("expected ring mismatch with %s to be recorded, got %+v", addr, status)
+	}
+	if status := remote.RingStatus(); status.MismatchedRequests != 1 {
+		t.Fatalf("expected one mismatched request on the remote node, got %+v", status)
+	}
+	if !pool.PeerStats()[addr].RingMismatch {
+		t.Fatalf("expected ring mismatch in peer stats")
+	}
+}
+
+// encodingTransport 记录响应的 Content-Encoding
+type encodingTransport struct {
+	encoding atomic.Value
+}
+
+func (t *encodingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err == nil {
+		t.encoding.Store(resp.Header.Get("Content-Encoding"))
+	}
+	return resp, err
+}
+
+func TestHTTPPoolCompression(t *testing.T) {
+	value := strings.Repeat("Value for key ", 100)
+	NewGroup("gzipGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(value), nil
+	}), WithCompression(compression.Gzip(gzip.BestSpeed)))
+	server := httptest.NewServer(NewHTTPPool("remote"))
+	defer server.Close()
+
+	transport := &encodingTransport{}
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{Transport: transport})
+	pool.Set(strings.TrimPrefix(server.URL, "http://"))
+	peer, _ := pool.PickPeer("key")
+
+	got, err := peer.Get("gzipGroup", "key")
+	if err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if string(got) != value {
+		t.Fatalf("Unexpected value, got %s", got)
+	}
+	if enc := transport.encoding.Load(); enc != "gzip" {
+		t.Fatalf("expected gzip response, got %q", enc)
+	}
+
+	// 已缓存的压缩数据按原样发送
+	stored, ok := GetGroup("gzipGroup").storedCompressed("key")
+	if !ok {
+		t.Fatalf("expected compressed value in cache")
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+defaultBasePath+"gzipGroup/key", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := (&http.Client{Transport: &http.Transport{DisableCompression: true}}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, stored) {
+		t.Fatalf("expected stored compressed bytes to be sent unchanged")
+	}
+
+	// 解压后超过 MaxValueSize 的响应被拒绝
+	small := NewHTTPPoolOpts("self", &HTTPPoolOptions{MaxValueSize: 100})
+	small.Set(strings.TrimPrefix(server.URL, "http://"))
+	peer, _ = small.PickPeer("key")
+	if _, err := peer.Get("gzipGroup", "key"); !errors.Is(err, compression.ErrTooLarge) {
+		t.Fatalf("expected oversized value to be rejected, got %v", err)
+	}
+
+	// 没有声明 Accept-Encoding 的请求收到原始数据
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err = client.Get(server.URL + defaultBasePath + "gzipGroup/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("unexpected encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
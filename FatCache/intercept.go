@@ -0,0 +1,130 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// LoadSource 表示一次加载的数据来源
+type LoadSource int
+
+const (
+	// SourceLocal 为调用本节点的 Getter
+	SourceLocal LoadSource = iota
+	// SourcePeer 为请求远端节点
+	SourcePeer
+)
+
+func (s LoadSource) String() string {
+	switch s {
+	case SourceLocal:
+		return "local"
+	case SourcePeer:
+		return "peer"
+	}
+	return fmt.Sprintf("LoadSource(%d)", int(s))
+}
+
+// LoadInfo 描述拦截器所在的一次加载
+type LoadInfo struct {
+	Group  string
+	Key    string
+	Source LoadSource
+	// Peer 为 SourcePeer 时请求的远端节点
+	Peer PeerGetter
+}
+
+// LoadFunc 执行一次加载
+type LoadFunc func(ctx context.Context) ([]byte, error)
+
+// Interceptor 包裹一次加载，调用 next 执行后续的拦截器和实际加载，可以修改 ctx 和结果
+type Interceptor func(ctx context.Context, info LoadInfo, next LoadFunc) ([]byte, error)
+
+// WithInterceptors 为 Group 的本地加载和远端加载添加拦截器，先添加的位于外层。
+// 远端加载的重试与对冲中每次请求都会经过拦截器
+func WithInterceptors(interceptors ...Interceptor) GroupOption {
+	return func(g *Group) {
+		g.interceptors = append(g.interceptors, interceptors...)
+	}
+}
+
+// intercept 通过拦截器链执行 load
+func (g *Group) intercept(ctx context.Context, info LoadInfo, load LoadFunc) ([]byte, error) {
+	for i := len(g.interceptors) - 1; i >= 0; i-- {
+		next, ic := load, g.interceptors[i]
+		load = func(ctx context.Context) ([]byte, error) {
+			return ic(ctx, info, next)
+		}
+	}
+	return load(ctx)
+}
+
+// TimingInterceptor 在每次加载结束后以耗时和结果调用 observe
+func TimingInterceptor(observe func(info LoadInfo, d time.Duration, err error)) Interceptor {
+	return func(ctx context.Context, info LoadInfo, next LoadFunc) ([]byte, error) {
+		start := time.Now()
+		b, err := next(ctx)
+		observe(info, time.Since(start), err)
+		return b, err
+	}
+}
+
+// RetryInterceptor 在加载失败后最多重试 retries 次，等待时间从 backoff 开始每次翻倍；
+// ctx 结束或加载被限流拒绝时不再重试
+func RetryInterceptor(retries int, backoff time.Duration) Interceptor {
+	return func(ctx context.Context, info LoadInfo, next LoadFunc) ([]byte, error) {
+		wait := backoff
+		for attempt := 0; ; attempt++ {
+			b, err := next(ctx)
+			if err == nil || attempt >= retries || ctx.Err() != nil || errors.Is(err, ErrOverloaded) {
+				return b, err
+			}
+			if wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				wait *= 2
+			}
+		}
+	}
+}
+
+// PanicError 是 RecoverInterceptor 把加载中的 panic 转换成的错误
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("fatcache: panic during load: %v", e.Value)
+}
+
+// RecoverInterceptor 把加载中的 panic 转换为 PanicError，避免一个 Getter 的错误使进程退出
+func RecoverInterceptor() Interceptor {
+	return func(ctx context.Context, info LoadInfo, next LoadFunc) (b []byte, err error) {
+		defer func() {
+			if v := recover(); v != nil {
+				b, err = nil, &PanicError{Value: v, Stack: debug.Stack()}
+			}
+		}()
+		return next(ctx)
+	}
+}
+
+// TraceFunc 在加载开始时调用，返回的 ctx 传给后续的加载，返回的函数在加载结束时以结果调用
+type TraceFunc func(ctx context.Context, info LoadInfo) (context.Context, func(err error))
+
+// TracingInterceptor 用 trace 记录每次加载
+func TracingInterceptor(trace TraceFunc) Interceptor {
+	return func(ctx context.Context, info LoadInfo, next LoadFunc) ([]byte, error) {
+		ctx, end := trace(ctx, info)
+		b, err := next(ctx)
+		end(err)
+		return b, err
+	}
+}
@@ -0,0 +1,114 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInterceptorChain(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, info LoadInfo, next LoadFunc) ([]byte, error) {
+			mu.Lock()
+			calls = append(calls, fmt.Sprintf("%s>%s:%s", name, info.Source, info.Key))
+			mu.Unlock()
+			b, err := next(ctx)
+			if err == nil {
+				b = append([]byte(name+"("), append(b, ')')...)
+			}
+			return b, err
+		}
+	}
+	var loads int32
+	group := NewGroup("interceptGroup", 1<<20, countingGetter(&loads),
+		WithInterceptors(record("outer"), record("inner")))
+
+	value, err := group.Get("key")
+	if err != nil || value.String() != "outer(inner(local:key))" {
+		t.Fatalf("unexpected value %q, err %v", value.String(), err)
+	}
+	if strings.Join(calls, ",") != "outer>local:key,inner>local:key" {
+		t.Fatalf("unexpected interceptor order: %v", calls)
+	}
+}
+
+func TestInterceptorPeerLoad(t *testing.T) {
+	var mu sync.Mutex
+	var sources []LoadInfo
+	var local int32
+	peer := &fakePeer{name: "a"}
+	group := NewGroup("interceptPeerGroup", 1<<20, countingGetter(&local),
+		WithInterceptors(TimingInterceptor(func(info LoadInfo, d time.Duration, err error) {
+			mu.Lock()
+			sources = append(sources, info)
+			mu.Unlock()
+		})))
+	group.RegisterPeerPicker(&fakePicker{peers: []PeerGetter{peer}})
+
+	if _, err := group.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 1 || sources[0].Source != SourcePeer || sources[0].Peer != peer {
+		t.Fatalf("expected one peer load to be observed, got %+v", sources)
+	}
+}
+
+func TestRetryAndRecoverInterceptors(t *testing.T) {
+	var attempts int
+	group := NewGroup("retryGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		attempts++
+		if key == "panic" {
+			panic("boom")
+		}
+		if attempts < 3 {
+			return nil, errors.New("transient")
+		}
+		return []byte("ok"), nil
+	}), WithInterceptors(RetryInterceptor(2, time.Millisecond), RecoverInterceptor()))
+
+	value, err := group.Get("key")
+	if err != nil || value.String() != "ok" || attempts != 3 {
+		t.Fatalf("expected success on third attempt, got %q, err %v after %d attempts", value.String(), err, attempts)
+	}
+
+	attempts = 0
+	_, err = group.Get("panic")
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "boom" || len(pe.Stack) == 0 {
+		t.Fatalf("expected panic to be recovered as PanicError, got %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected recovered panics to be retried, got %d attempts", attempts)
+	}
+}
+
+type traceKey struct{}
+
+func TestTracingInterceptor(t *testing.T) {
+	var ended []error
+	var seen interface{}
+	group := NewGroup("traceGroup", 1<<20, nil, WithInterceptors(
+		TracingInterceptor(func(ctx context.Context, info LoadInfo) (context.Context, func(error)) {
+			return context.WithValue(ctx, traceKey{}, "span:"+info.Key), func(err error) {
+				ended = append(ended, err)
+			}
+		}),
+		func(ctx context.Context, info LoadInfo, next LoadFunc) ([]byte, error) {
+			seen = ctx.Value(traceKey{})
+			return nil, errors.New("not found")
+		},
+	))
+
+	if _, err := group.Get("key"); err == nil {
+		t.Fatalf("expected load error")
+	}
+	if seen != "span:key" || len(ended) != 1 || ended[0] == nil {
+		t.Fatalf("unexpected trace: seen %v, ended %v", seen, ended)
+	}
+}
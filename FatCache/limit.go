@@ -0,0 +1,159 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded 表示本地加载因超过 LoadLimits 被拒绝，可用 errors.Is 判断
+var ErrOverloaded = errors.New("fatcache: load limit exceeded")
+
+// OverloadError 是加载在等待超过 MaxWait 后返回的错误
+type OverloadError struct {
+	Group string
+	Key   string
+	// Limit 为触发拒绝的限制，"concurrency" 或 "rate"
+	Limit  string
+	Waited time.Duration
+}
+
+func (e *OverloadError) Error() string {
+	return fmt.Sprintf("fatcache: group %s: %s limit exceeded loading key %s after %v",
+		e.Group, e.Limit, e.Key, e.Waited)
+}
+
+func (e *OverloadError) Unwrap() error {
+	return ErrOverloaded
+}
+
+// LoadLimits 限制 Group 调用 Getter 的并发数和速率，零值字段表示不限制
+type LoadLimits struct {
+	// MaxConcurrent 为同时进行的本地加载数量上限
+	MaxConcurrent int
+	// Rate 为每秒本地加载次数上限，Burst 为允许的突发数量，默认为 1
+	Rate  float64
+	Burst int
+	// MaxWait 为排队等待的最长时间，超过后返回 OverloadError；为 0 时只受 ctx 限制
+	MaxWait time.Duration
+}
+
+// WithLoadLimits 为 Group 的本地加载设置并发和速率限制，超出限制的加载排队等待。
+// 同一 key 的并发请求由 singleflight 合并，排队使用的是发起加载的请求的 ctx：
+// 它被取消时，等待同一 key 的其他请求也会收到 ctx 的错误，需要时可以设置 MaxWait 限制排队时间
+func WithLoadLimits(l LoadLimits) GroupOption {
+	return func(g *Group) {
+		if l.Rate > 0 && l.Burst <= 0 {
+			l.Burst = 1
+		}
+		g.limiter = newLoadLimiter(g, l)
+	}
+}
+
+type loadLimiter struct {
+	group  *Group
+	limits LoadLimits
+	sem    chan struct{}
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	inFlight atomic.Int64
+	queued   atomic.Int64
+	rejected atomic.Int64
+	waitNs   atomic.Int64
+}
+
+func newLoadLimiter(g *Group, l LoadLimits) *loadLimiter {
+	lim := &loadLimiter{group: g, limits: l, tokens: float64(l.Burst), last: time.Now()}
+	if l.MaxConcurrent > 0 {
+		lim.sem = make(chan struct{}, l.MaxConcurrent)
+	}
+	return lim
+}
+
+// acquire 等待速率和并发限制，成功时返回释放并发名额的函数
+func (l *loadLimiter) acquire(ctx context.Context, key string) (func(), error) {
+	start := time.Now()
+	var deadline <-chan time.Time
+	if l.limits.MaxWait > 0 {
+		timer := time.NewTimer(l.limits.MaxWait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	l.queued.Add(1)
+	defer l.queued.Add(-1)
+	defer func() { l.waitNs.Add(int64(time.Since(start))) }()
+
+	reject := func(limit string) error {
+		l.rejected.Add(1)
+		return &OverloadError{Group: l.group.name, Key: key, Limit: limit, Waited: time.Since(start)}
+	}
+
+	if l.limits.Rate > 0 {
+		wait, ok := l.reserve(start)
+		if !ok {
+			return nil, reject("rate")
+		}
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				l.refund()
+				return nil, ctx.Err()
+			}
+		}
+	}
+	if l.sem != nil {
+		select {
+		case l.sem <- struct{}{}:
+		case <-deadline:
+			l.refund()
+			return nil, reject("concurrency")
+		case <-ctx.Done():
+			l.refund()
+			return nil, ctx.Err()
+		}
+	}
+	l.inFlight.Add(1)
+	return func() {
+		l.inFlight.Add(-1)
+		if l.sem != nil {
+			<-l.sem
+		}
+	}, nil
+}
+
+// reserve 从令牌桶中预留一个令牌，返回需要等待的时间；等待超过 MaxWait 时不预留
+func (l *loadLimiter) reserve(now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(float64(l.limits.Burst), l.tokens+now.Sub(l.last).Seconds()*l.limits.Rate)
+	l.last = now
+	var wait time.Duration
+	if l.tokens < 1 {
+		wait = time.Duration((1 - l.tokens) / l.limits.Rate * float64(time.Second))
+	}
+	if l.limits.MaxWait > 0 && wait > l.limits.MaxWait {
+		return 0, false
+	}
+	l.tokens--
+	return wait, true
+}
+
+// refund 归还 reserve 预留的令牌，用于预留后没有执行的加载
+func (l *loadLimiter) refund() {
+	if l.limits.Rate <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens = math.Min(float64(l.limits.Burst), l.tokens+1)
+}
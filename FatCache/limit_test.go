@@ -0,0 +1,139 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadLimitsConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		<-release
+		running.Add(-1)
+		return []byte("v:" + key), nil
+	})
+	group := NewGroup("limitGroup", 1<<20, getter,
+		WithLoadLimits(LoadLimits{MaxConcurrent: 2, MaxWait: 50 * time.Millisecond}))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := group.Get(fmt.Sprintf("key%d", i))
+			errs <- err
+		}(i)
+	}
+	waitFor(t, "queued loads to be rejected", func() bool {
+		return group.Stats().LoadsRejected == 3
+	})
+	if s := group.Stats(); s.LoadsInFlight != 2 || s.LoadsQueued != 0 {
+		t.Fatalf("unexpected limiter stats: %+v", s)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	var overloaded int
+	for err := range errs {
+		var oe *OverloadError
+		if errors.As(err, &oe) {
+			overloaded++
+			if !errors.Is(err, ErrOverloaded) || oe.Limit != "concurrency" || oe.Group != "limitGroup" {
+				t.Fatalf("unexpected overload error: %v", err)
+			}
+		} else if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if overloaded != 3 || peak.Load() != 2 {
+		t.Fatalf("expected 3 rejected loads and at most 2 concurrent, got %d and %d", overloaded, peak.Load())
+	}
+	if s := group.Stats(); s.LoadsInFlight != 0 || s.LocalLoads != 2 || s.LoadWait <= 0 {
+		t.Fatalf("unexpected stats after loads: %+v", s)
+	}
+}
+
+func TestLoadLimitsRate(t *testing.T) {
+	var loads int32
+	group := NewGroup("rateGroup", 1<<20, countingGetter(&loads),
+		WithLoadLimits(LoadLimits{Rate: 100, Burst: 2, MaxWait: 25 * time.Millisecond}))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := group.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatalf("expected load %d to wait for a token: %v", i, err)
+		}
+	}
+	// 突发 2 个之后每 10ms 一个令牌
+	if elapsed := time.Since(start); elapsed < 15*time.Millisecond {
+		t.Fatalf("expected rate limit to delay loads, took %v", elapsed)
+	}
+
+	// 并发的加载预计等待超过 MaxWait 时立即拒绝
+	var rejected atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := group.Get(fmt.Sprintf("burst%d", i))
+			var oe *OverloadError
+			if errors.As(err, &oe) && oe.Limit == "rate" {
+				rejected.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if rejected.Load() == 0 || group.Stats().LoadsRejected != rejected.Load() {
+		t.Fatalf("expected rate limit rejections, got %d", rejected.Load())
+	}
+}
+
+func TestLoadLimitsRefund(t *testing.T) {
+	group := NewGroup("refundGroup", 1<<20, nil)
+	lim := newLoadLimiter(group, LoadLimits{Rate: 1, Burst: 2, MaxConcurrent: 1, MaxWait: 50 * time.Millisecond})
+
+	release, err := lim.acquire(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 令牌已预留但等不到并发名额的加载归还令牌
+	var oe *OverloadError
+	if _, err := lim.acquire(context.Background(), "b"); !errors.As(err, &oe) || oe.Limit != "concurrency" {
+		t.Fatalf("expected concurrency rejection, got %v", err)
+	}
+	release()
+	release, err = lim.acquire(context.Background(), "c")
+	if err != nil {
+		t.Fatalf("expected refunded token to be available, got %v", err)
+	}
+	release()
+
+	// 调用方放弃等待时同样归还令牌
+	lim = newLoadLimiter(group, LoadLimits{Rate: 1, Burst: 1})
+	release, _ = lim.acquire(context.Background(), "a")
+	release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := lim.acquire(ctx, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ctx error, got %v", err)
+	}
+	if lim.tokens < -0.5 {
+		t.Fatalf("expected token of cancelled load to be refunded, tokens %.2f", lim.tokens)
+	}
+}
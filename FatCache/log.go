@@ -0,0 +1,142 @@
+package fatcache
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 为日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// Field 是日志中的一个键值对
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 构造一个 Field
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// Logger 输出带级别和字段的日志，需要支持并发调用
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// defaultLogger 为未配置 Logger 的 Group 和 HTTPPool 使用，只输出警告和错误
+var defaultLogger Logger = NewTextLogger(os.Stderr, LevelWarn)
+
+// NopLogger 返回丢弃所有日志的 Logger
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...Field) {}
+
+// NewTextLogger 返回把不低于 min 级别的日志按行写入 w 的 Logger，格式为
+// "时间 级别 消息 key=value ..."
+func NewTextLogger(w io.Writer, min Level) Logger {
+	return &textLogger{w: w, min: min}
+}
+
+type textLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+}
+
+func (l *textLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(time.Now().Format(time.RFC3339))
+	b.WriteByte(' ')
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	b.WriteByte('\n')
+	l.mu.Lock()
+	io.WriteString(l.w, b.String())
+	l.mu.Unlock()
+}
+
+// WithLogger 设置 Group 的 Logger，默认只向标准错误输出警告和错误，l 为 nil 时不输出日志
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		if l == nil {
+			l = NopLogger()
+		}
+		g.logger = l
+	}
+}
+
+func (g *Group) log(level Level, msg string, fields ...Field) {
+	g.logger.Log(level, msg, append(fields, F("group", g.name))...)
+}
+
+// Hooks 是 Group 的事件回调，均在触发事件的 goroutine 中同步调用，应尽快返回；
+// 未设置的回调被忽略
+type Hooks struct {
+	// OnHit 与 OnMiss 在 Get 命中或未命中本节点的内存缓存时调用
+	OnHit  func(group, key string)
+	OnMiss func(group, key string)
+	// OnLoad 在每次调用 Getter 或请求远端节点后调用，远端重试与对冲的每次请求都会触发
+	OnLoad func(info LoadInfo, d time.Duration, err error)
+	// OnEvict 在数据因容量被内存缓存淘汰后调用，size 为缓存中的字节数
+	OnEvict func(group, key string, size int)
+	// OnPeerError 在请求远端节点失败时调用
+	OnPeerError func(info LoadInfo, err error)
+}
+
+// WithHooks 设置 Group 的事件回调
+func WithHooks(h Hooks) GroupOption {
+	return func(g *Group) {
+		g.hooks = h
+	}
+}
+
+// observeLoad 在一次加载结束后记录日志并调用回调
+func (g *Group) observeLoad(info LoadInfo, start time.Time, err error) {
+	d := time.Since(start)
+	if g.hooks.OnLoad != nil {
+		g.hooks.OnLoad(info, d, err)
+	}
+	if err != nil && info.Source == SourcePeer {
+		g.log(LevelWarn, "failed to get from peer", F("key", info.Key), F("err", err))
+		if g.hooks.OnPeerError != nil {
+			g.hooks.OnPeerError(info, err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package fatcache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTextLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewTextLogger(&buf, LevelInfo)
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelWarn, "peer down", F("peer", "10.0.0.1"), F("attempt", 2))
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") || strings.Count(out, "\n") != 1 {
+		t.Fatalf("expected only the warning to be logged, got %q", out)
+	}
+	if !strings.HasSuffix(out, " WARN peer down peer=10.0.0.1 attempt=2\n") {
+		t.Fatalf("unexpected log line %q", out)
+	}
+}
+
+type recordLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *recordLogger) Log(level Level, msg string, fields ...Field) {
+	var b strings.Builder
+	b.WriteString(level.String() + " " + msg)
+	for _, f := range fields {
+		b.WriteString(" " + f.Key)
+	}
+	l.mu.Lock()
+	l.lines = append(l.lines, b.String())
+	l.mu.Unlock()
+}
+
+func TestGroupLoggerAndHooks(t *testing.T) {
+	var events []string
+	var loads []LoadInfo
+	logger := &recordLogger{}
+	peer := &fakePeer{name: "a", failures: 1}
+	group := NewGroup("hookGroup", 16, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("value:" + key), nil
+	}), WithLogger(logger), WithHooks(Hooks{
+		OnHit:  func(group, key string) { events = append(events, "hit "+key) },
+		OnMiss: func(group, key string) { events = append(events, "miss "+key) },
+		OnLoad: func(info LoadInfo, d time.Duration, err error) {
+			loads = append(loads, info)
+		},
+		OnEvict: func(group, key string, size int) { events = append(events, "evict "+key) },
+		OnPeerError: func(info LoadInfo, err error) {
+			events = append(events, "peer error "+info.Key)
+		},
+	}))
+	group.RegisterPeerPicker(&fakePicker{peers: []PeerGetter{peer}})
+
+	// 缓存 key 带有代数前缀，回调中的 key 不带前缀
+	group.BumpGeneration(context.Background())
+	group.Get("k1") // 远端失败后在本地加载
+	group.Get("k1")
+	group.Get("k2") // 容量只够一个，k1 被淘汰
+
+	want := "[miss k1 peer error k1 hit k1 miss k2 evict k1]"
+	if got := "[" + strings.Join(events, " ") + "]"; got != want {
+		t.Fatalf("unexpected events %s", got)
+	}
+	if len(loads) != 3 || loads[0].Source != SourcePeer || loads[1].Source != SourceLocal || loads[2].Source != SourcePeer {
+		t.Fatalf("unexpected loads %+v", loads)
+	}
+	if logger.lines[0] != "DEBUG cache miss key group" {
+		t.Fatalf("unexpected log lines %v", logger.lines)
+	}
+	var warned bool
+	for _, line := range logger.lines {
+		if line == "WARN failed to get from peer key err group" {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Fatalf("expected a warning for the peer error, got %v", logger.lines)
+	}
+}
+
+func TestHTTPPoolLogger(t *testing.T) {
+	logger := &recordLogger{}
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{Logger: logger})
+	pool.Set("self", "other")
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		pool.PickPeer(key)
+	}
+	if len(logger.lines) == 0 || logger.lines[0] != "DEBUG pick peer key peer" {
+		t.Fatalf("expected pick peer to be logged to the pool logger, got %v", logger.lines)
+	}
+}
+
+func TestWithLoggerNil(t *testing.T) {
+	group := NewGroup("nilLoggerGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("not found")
+	}), WithLogger(nil))
+	if _, err := group.Get("key"); err == nil {
+		t.Fatalf("expected load error")
+	}
+}
@@ -2,15 +2,23 @@ package lru
 
 import (
 	"container/list"
-	"fmt"
+	"unsafe"
 )
 
+// EntryOverhead 估算每个缓存项在 key 和 value 数据之外占用的内存：
+// list.Element、entry 结构体，以及 map 中的 key、指针和 tophash，按约 80% 的装载率计算
+var EntryOverhead = int64(unsafe.Sizeof(list.Element{})+unsafe.Sizeof(entry{})) +
+	int64(unsafe.Sizeof("")+unsafe.Sizeof(&list.Element{})+1)*5/4
+
 type Cache struct {
 	maxBytes int64
 	nbytes   int64
+	overhead int64
 	ll       *list.List
 	cache    map[string]*list.Element
 	onEvict  func(key string, value Value)
+	// seq 在每次添加或访问时递增，链表从旧到新按 entry.seq 递增
+	seq uint64
 }
 
 type Value interface {
@@ -20,6 +28,7 @@ type Value interface {
 type entry struct {
 	key   string
 	value Value
+	seq   uint64
 }
 
 func (e *entry) Len() int {
@@ -42,28 +51,46 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		c.touch(kv)
 		return kv.value, true
 	}
 	return
 }
 
+func (c *Cache) touch(kv *entry) {
+	c.seq++
+	kv.seq = c.seq
+}
+
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
 		c.ll.Remove(ele)
 		kv := ele.Value.(*entry)
 		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+		c.nbytes -= c.size(kv.key, kv.value)
 		if c.onEvict != nil {
 			c.onEvict(kv.key, kv.value)
 		}
 	}
 }
 
+// Remove 删除 key 对应的缓存项，返回 key 是否存在
+func (c *Cache) Remove(key string) bool {
+	ele, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= c.size(kv.key, kv.value)
+	return true
+}
+
 func (c *Cache) Add(key string, value Value) {
 
-	if int64(len(key))+int64(value.Len()) > c.maxBytes {
-		fmt.Printf("Value for key %s is too large to cache\n", key)
+	if c.size(key, value) > c.maxBytes {
 		return // 超大值直接返回，不缓存
 	}
 
@@ -72,11 +99,13 @@ func (c *Cache) Add(key string, value Value) {
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.Len())
 		kv.value = value
+		c.touch(kv)
 	} else {
-		ele := &entry{key, value}
+		ele := &entry{key: key, value: value}
+		c.touch(ele)
 		listEle := c.ll.PushFront(ele)
 		c.cache[key] = listEle
-		c.nbytes += int64(len(key)) + int64(value.Len())
+		c.nbytes += c.size(key, value)
 	}
 	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
 		c.RemoveOldest()
@@ -86,3 +115,57 @@ func (c *Cache) Add(key string, value Value) {
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
+
+// Keys 按从新到旧的顺序返回所有 key
+func (c *Cache) Keys() []string {
+	keys := make([]string, 0, c.ll.Len())
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		keys = append(keys, ele.Value.(*entry).key)
+	}
+	return keys
+}
+
+// Cursor 记录 KeysAfter 遍历到的位置，零值表示从最旧的 key 开始
+type Cursor struct {
+	key string
+	seq uint64
+}
+
+// KeysAfter 按从旧到新的顺序返回 cursor 之后最多 n 个 key 及下一批使用的游标，
+// 返回少于 n 个时已到达最新的 key。分批调用时每批之间可以释放锁：
+// 期间被访问或添加的 key 移到最新一侧，仍会被之后的批次返回（已返回过的会再出现一次），
+// 游标处的 key 被访问或删除时按 seq 跳过已返回的部分，不会遗漏 key
+func (c *Cache) KeysAfter(cursor Cursor, n int) ([]string, Cursor) {
+	ele := c.ll.Back()
+	if cursor.seq != 0 {
+		if e, ok := c.cache[cursor.key]; ok && e.Value.(*entry).seq == cursor.seq {
+			ele = e.Prev()
+		} else {
+			for ele != nil && ele.Value.(*entry).seq <= cursor.seq {
+				ele = ele.Prev()
+			}
+		}
+	}
+	var keys []string
+	for ; ele != nil && len(keys) < n; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		keys = append(keys, kv.key)
+		cursor = Cursor{kv.key, kv.seq}
+	}
+	return keys, cursor
+}
+
+// SetEntryOverhead 设置每个缓存项额外计入的字节数，例如 EntryOverhead，
+// 需要在添加数据之前调用
+func (c *Cache) SetEntryOverhead(n int64) {
+	c.overhead = n
+}
+
+// Bytes 返回已计入的字节数
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+func (c *Cache) size(key string, value Value) int64 {
+	return int64(len(key)) + int64(value.Len()) + c.overhead
+}
@@ -77,9 +77,9 @@ func TestOnEvict(t *testing.T) {
 		evictedKeys = append(evictedKeys, key)
 	}
 	cache := New(10, onEvict)
-	cache.Add("key1", String("12345")) // 5 bytes
-	cache.Add("key2", String("12345")) // 5 bytes
-	cache.Add("key3", String("12345")) // 5 bytes, triggers eviction
+	cache.Add("key1", String("1")) // 5 bytes
+	cache.Add("key2", String("1")) // 5 bytes
+	cache.Add("key3", String("1")) // 5 bytes, triggers eviction
 
 	assert.Equal(t, 1, len(evictedKeys))
 	assert.Equal(t, "key1", evictedKeys[0])
@@ -130,3 +130,68 @@ func TestStress(t *testing.T) {
 		assert.False(t, ok)
 	}
 }
+
+func TestRemove(t *testing.T) {
+	cache := New(1024, nil)
+	cache.Add("key1", String("value1"))
+	cache.Add("key2", String("value2"))
+
+	assert.True(t, cache.Remove("key1"))
+	assert.False(t, cache.Remove("key1"))
+	_, ok := cache.Get("key1")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+	assert.Equal(t, int64(len("key2")+len("value2")), cache.nbytes)
+}
+
+func TestEntryOverhead(t *testing.T) {
+	cache := New(100, nil)
+	cache.SetEntryOverhead(40)
+	cache.Add("k1", String("v1"))
+	assert.Equal(t, int64(44), cache.Bytes())
+
+	// 计入开销后第三项超出容量
+	cache.Add("k2", String("v2"))
+	cache.Add("k3", String("v3"))
+	assert.Equal(t, 2, cache.Len())
+	cache.Remove("k3")
+	assert.Equal(t, int64(44), cache.Bytes())
+}
+
+func TestKeys(t *testing.T) {
+	cache := New(1024, nil)
+	assert.Empty(t, cache.Keys())
+	cache.Add("key1", String("value1"))
+	cache.Add("key2", String("value2"))
+	cache.Add("key3", String("value3"))
+	cache.Get("key1")
+	assert.Equal(t, []string{"key1", "key3", "key2"}, cache.Keys())
+
+	keys, cursor := cache.KeysAfter(Cursor{}, 2)
+	assert.Equal(t, []string{"key2", "key3"}, keys)
+	// 两批之间被访问的 key 移到最新一侧，仍在之后返回
+	cache.Get("key2")
+	keys, cursor = cache.KeysAfter(cursor, 2)
+	assert.Equal(t, []string{"key1", "key2"}, keys)
+	keys, _ = cache.KeysAfter(cursor, 2)
+	assert.Empty(t, keys)
+}
+
+func TestKeysAfterLostCursor(t *testing.T) {
+	cache := New(1024, nil)
+	for i := 0; i < 6; i++ {
+		cache.Add(fmt.Sprintf("key%d", i), String("v"))
+	}
+	keys, cursor := cache.KeysAfter(Cursor{}, 2)
+	assert.Equal(t, []string{"key0", "key1"}, keys)
+
+	// 游标处的 key 被访问后仍从原位置继续，key1 排到最后再出现一次
+	cache.Get("key1")
+	keys, cursor = cache.KeysAfter(cursor, 2)
+	assert.Equal(t, []string{"key2", "key3"}, keys)
+
+	// 游标处的 key 被删除后同样不遗漏
+	cache.Remove("key3")
+	keys, _ = cache.KeysAfter(cursor, 10)
+	assert.Equal(t, []string{"key4", "key5", "key1"}, keys)
+}
@@ -0,0 +1,182 @@
+package lru
+
+// Options 配置 TypedCache 的容量，MaxEntries 与 MaxBytes 为 0 时不限制
+type Options[K comparable, V any] struct {
+	// MaxEntries 最多保存的缓存项数量
+	MaxEntries int
+	// MaxBytes 所有缓存项大小之和的上限，大小由 Size 计算
+	MaxBytes int64
+	// Size 计算缓存项的大小，为 nil 时 V 实现了 Len() 则用 Len()，string 类型的 key 计入 key 的长度
+	Size func(key K, value V) int64
+	// OnEvict 缓存项因容量限制被淘汰时调用，Remove 不会触发
+	OnEvict func(key K, value V)
+}
+
+type node[K comparable, V any] struct {
+	key        K
+	value      V
+	size       int64
+	prev, next *node[K, V]
+}
+
+// TypedCache 是泛型的 LRU 缓存，同时支持按数量和按大小限制容量。
+// TypedCache 不是并发安全的
+type TypedCache[K comparable, V any] struct {
+	opts  Options[K, V]
+	items map[K]*node[K, V]
+	// root 是哨兵节点，root.next 为最近使用的缓存项，root.prev 为最久未使用的
+	root   node[K, V]
+	nbytes int64
+}
+
+// NewTyped 创建 TypedCache
+func NewTyped[K comparable, V any](opts Options[K, V]) *TypedCache[K, V] {
+	if opts.Size == nil {
+		opts.Size = defaultSize[K, V]
+	}
+	c := &TypedCache[K, V]{opts: opts, items: make(map[K]*node[K, V])}
+	c.root.next = &c.root
+	c.root.prev = &c.root
+	return c
+}
+
+func defaultSize[K comparable, V any](key K, value V) int64 {
+	var n int64
+	if s, ok := any(key).(string); ok {
+		n += int64(len(s))
+	}
+	if v, ok := any(value).(Value); ok {
+		n += int64(v.Len())
+	}
+	return n
+}
+
+func (c *TypedCache[K, V]) unlink(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+}
+
+func (c *TypedCache[K, V]) pushFront(n *node[K, V]) {
+	n.prev = &c.root
+	n.next = c.root.next
+	c.root.next.prev = n
+	c.root.next = n
+}
+
+// Add 添加或更新缓存项，超过 MaxBytes 的单个缓存项不会被缓存
+func (c *TypedCache[K, V]) Add(key K, value V) {
+	size := c.opts.Size(key, value)
+	if c.opts.MaxBytes > 0 && size > c.opts.MaxBytes {
+		c.Remove(key)
+		return
+	}
+	if n, ok := c.items[key]; ok {
+		c.unlink(n)
+		c.pushFront(n)
+		c.nbytes += size - n.size
+		n.value, n.size = value, size
+	} else {
+		n := &node[K, V]{key: key, value: value, size: size}
+		c.pushFront(n)
+		c.items[key] = n
+		c.nbytes += size
+	}
+	c.evict()
+}
+
+// Get 返回 key 对应的值，并将其标记为最近使用
+func (c *TypedCache[K, V]) Get(key K) (value V, ok bool) {
+	n, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	c.unlink(n)
+	c.pushFront(n)
+	return n.value, true
+}
+
+// Peek 返回 key 对应的值，不改变其使用顺序
+func (c *TypedCache[K, V]) Peek(key K) (value V, ok bool) {
+	if n, ok := c.items[key]; ok {
+		return n.value, true
+	}
+	return value, false
+}
+
+// Contains 判断 key 是否在缓存中，不改变其使用顺序
+func (c *TypedCache[K, V]) Contains(key K) bool {
+	_, ok := c.items[key]
+	return ok
+}
+
+// Remove 删除 key 对应的缓存项，返回 key 是否存在
+func (c *TypedCache[K, V]) Remove(key K) bool {
+	n, ok := c.items[key]
+	if !ok {
+		return false
+	}
+	c.unlink(n)
+	delete(c.items, key)
+	c.nbytes -= n.size
+	return true
+}
+
+// RemoveOldest 淘汰最久未使用的缓存项
+func (c *TypedCache[K, V]) RemoveOldest() (key K, value V, ok bool) {
+	n := c.root.prev
+	if n == &c.root {
+		return key, value, false
+	}
+	c.unlink(n)
+	delete(c.items, n.key)
+	c.nbytes -= n.size
+	if c.opts.OnEvict != nil {
+		c.opts.OnEvict(n.key, n.value)
+	}
+	return n.key, n.value, true
+}
+
+// Keys 按从最近使用到最久未使用的顺序返回所有 key
+func (c *TypedCache[K, V]) Keys() []K {
+	keys := make([]K, 0, len(c.items))
+	for n := c.root.next; n != &c.root; n = n.next {
+		keys = append(keys, n.key)
+	}
+	return keys
+}
+
+// Range 按从最近使用到最久未使用的顺序遍历缓存项，f 返回 false 时停止。
+// 遍历过程中不能修改缓存
+func (c *TypedCache[K, V]) Range(f func(key K, value V) bool) {
+	for n := c.root.next; n != &c.root; n = n.next {
+		if !f(n.key, n.value) {
+			return
+		}
+	}
+}
+
+// Resize 修改容量限制，返回因此被淘汰的缓存项数量
+func (c *TypedCache[K, V]) Resize(maxEntries int, maxBytes int64) int {
+	c.opts.MaxEntries, c.opts.MaxBytes = maxEntries, maxBytes
+	return c.evict()
+}
+
+func (c *TypedCache[K, V]) evict() int {
+	evicted := 0
+	for (c.opts.MaxEntries > 0 && len(c.items) > c.opts.MaxEntries) ||
+		(c.opts.MaxBytes > 0 && c.nbytes > c.opts.MaxBytes) {
+		c.RemoveOldest()
+		evicted++
+	}
+	return evicted
+}
+
+// Len 返回缓存项数量
+func (c *TypedCache[K, V]) Len() int {
+	return len(c.items)
+}
+
+// Bytes 返回所有缓存项大小之和
+func (c *TypedCache[K, V]) Bytes() int64 {
+	return c.nbytes
+}
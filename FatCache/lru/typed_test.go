@@ -0,0 +1,99 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedCacheMaxEntries(t *testing.T) {
+	var evicted []int
+	cache := NewTyped(Options[int, string]{
+		MaxEntries: 2,
+		OnEvict:    func(key int, value string) { evicted = append(evicted, key) },
+	})
+	cache.Add(1, "a")
+	cache.Add(2, "b")
+	cache.Get(1)
+	cache.Add(3, "c")
+
+	assert.Equal(t, []int{2}, evicted)
+	assert.Equal(t, []int{3, 1}, cache.Keys())
+	assert.False(t, cache.Contains(2))
+}
+
+func TestTypedCachePeek(t *testing.T) {
+	cache := NewTyped(Options[string, int]{MaxEntries: 2})
+	cache.Add("a", 1)
+	cache.Add("b", 2)
+
+	// Peek 与 Contains 不改变使用顺序，a 仍然最先被淘汰
+	v, ok := cache.Peek("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	assert.True(t, cache.Contains("a"))
+	cache.Add("c", 3)
+	assert.False(t, cache.Contains("a"))
+
+	_, ok = cache.Peek("a")
+	assert.False(t, ok)
+}
+
+func TestTypedCacheSize(t *testing.T) {
+	cache := NewTyped(Options[string, []byte]{
+		MaxBytes: 10,
+		Size:     func(key string, value []byte) int64 { return int64(len(value)) },
+	})
+	cache.Add("a", make([]byte, 4))
+	cache.Add("b", make([]byte, 4))
+	assert.Equal(t, int64(8), cache.Bytes())
+
+	cache.Add("c", make([]byte, 4))
+	assert.Equal(t, []string{"c", "b"}, cache.Keys())
+
+	// 更新已有缓存项时重新计算大小
+	cache.Add("b", make([]byte, 1))
+	assert.Equal(t, int64(5), cache.Bytes())
+
+	// 超过容量的单个缓存项不会被缓存
+	cache.Add("big", make([]byte, 11))
+	assert.False(t, cache.Contains("big"))
+}
+
+func TestTypedCacheDefaultSize(t *testing.T) {
+	cache := NewTyped(Options[string, String]{MaxBytes: 10})
+	cache.Add("k1", String("1234"))
+	assert.Equal(t, int64(6), cache.Bytes())
+	cache.Add("k2", String("1234"))
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestTypedCacheRemoveAndRange(t *testing.T) {
+	cache := NewTyped(Options[string, int]{})
+	for i, k := range []string{"a", "b", "c"} {
+		cache.Add(k, i)
+	}
+	assert.True(t, cache.Remove("b"))
+	assert.False(t, cache.Remove("b"))
+
+	var keys []string
+	cache.Range(func(key string, value int) bool {
+		keys = append(keys, key)
+		return false
+	})
+	assert.Equal(t, []string{"c"}, keys)
+	assert.Equal(t, 2, cache.Len())
+}
+
+func TestTypedCacheResize(t *testing.T) {
+	cache := NewTyped(Options[int, int]{})
+	for i := 0; i < 5; i++ {
+		cache.Add(i, i)
+	}
+	assert.Equal(t, 3, cache.Resize(2, 0))
+	assert.Equal(t, []int{4, 3}, cache.Keys())
+
+	key, _, ok := cache.RemoveOldest()
+	assert.True(t, ok)
+	assert.Equal(t, 3, key)
+}
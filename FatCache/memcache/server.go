@@ -0,0 +1,326 @@
+// Package memcache 为 fatcache 提供 memcached 文本协议的访问入口，
+// get 命令走 Group 的正常加载流程，未命中时仍由负责节点和 Getter 加载
+package memcache
+
+import (
+	"bufio"
+	"errors"
+	"fatcache"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	maxValueLen = 1 << 20
+	// maxLineLen 为命令行的长度上限，memcached 的 key 最长 250 字节，足够一次 get 几十个 key
+	maxLineLen = 8 << 10
+)
+
+// Server 把 memcached 命令映射到 fatcache 的 Group 上。
+//
+// key 的格式为 "<group>:<key>"，不带前缀的 key 使用 Default。
+// fatcache 不保存 flags 和过期时间，返回的 flags 总为 0。
+type Server struct {
+	// Lookup 按名称查找 Group，默认为 fatcache.GetGroup
+	Lookup func(name string) *fatcache.Group
+	// Default 为不带 group 前缀的 key 使用的 Group，可以为 nil
+	Default *fatcache.Group
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+
+	cmdGet, cmdSet, getHits, getMisses atomic.Int64
+	currConns, totalConns              atomic.Int64
+}
+
+func NewServer(lookup func(name string) *fatcache.Group, def *fatcache.Group) *Server {
+	if lookup == nil {
+		lookup = fatcache.GetGroup
+	}
+	return &Server{Lookup: lookup, Default: def, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe 监听 addr 并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在 l 上接受连接，直到 Close 被调用
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭监听和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+var (
+	errClient      = errors.New("bad command line format")
+	errLineTooLong = errors.New("line too long")
+)
+
+// fatalError 包装的错误之后无法确定下一条命令的起始位置，回复后关闭连接
+type fatalError struct {
+	error
+}
+
+func (e fatalError) Unwrap() error {
+	return e.error
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.currConns.Add(1)
+	s.totalConns.Add(1)
+	defer func() {
+		s.currConns.Add(-1)
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if errors.Is(err, errLineTooLong) {
+				fmt.Fprintf(w, "CLIENT_ERROR %v\r\n", err)
+				w.Flush()
+			}
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			fmt.Fprint(w, "ERROR\r\n")
+		} else if args[0] == "quit" {
+			w.Flush()
+			return
+		} else if err := s.dispatch(r, w, args); err != nil {
+			if !errors.Is(err, errClient) {
+				return
+			}
+			fmt.Fprintf(w, "CLIENT_ERROR %v\r\n", err)
+			if errors.As(err, new(fatalError)) {
+				w.Flush()
+				return
+			}
+		}
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) dispatch(r *bufio.Reader, w *bufio.Writer, args []string) error {
+	switch args[0] {
+	case "get", "gets":
+		if len(args) < 2 {
+			fmt.Fprint(w, "ERROR\r\n")
+			return nil
+		}
+		for _, arg := range args[1:] {
+			s.cmdGet.Add(1)
+			g, key, ok := s.resolve(arg)
+			if !ok {
+				s.getMisses.Add(1)
+				continue
+			}
+			value, err := g.Get(key)
+			if err != nil {
+				s.getMisses.Add(1)
+				continue
+			}
+			s.getHits.Add(1)
+			b := value.ByteSlice()
+			if args[0] == "gets" {
+				fmt.Fprintf(w, "VALUE %s 0 %d %d\r\n", arg, len(b), casUnique(b))
+			} else {
+				fmt.Fprintf(w, "VALUE %s 0 %d\r\n", arg, len(b))
+			}
+			w.Write(b)
+			w.WriteString("\r\n")
+		}
+		fmt.Fprint(w, "END\r\n")
+	case "set", "add":
+		// <command> <key> <flags> <exptime> <bytes> [noreply]
+		// 命令行无法解析时不知道数据块的长度，只能关闭连接
+		if len(args) != 5 && len(args) != 6 {
+			return fatalError{errClient}
+		}
+		size, err := strconv.Atoi(args[4])
+		if err != nil || size < 0 {
+			return fatalError{errClient}
+		}
+		if size > maxValueLen {
+			// 与 memcached 一样跳过数据块，连接可以继续使用
+			if _, err := io.CopyN(io.Discard, r, int64(size)+2); err != nil {
+				return err
+			}
+			fmt.Fprint(w, "SERVER_ERROR object too large for cache\r\n")
+			return nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if data[size] != '\r' || data[size+1] != '\n' {
+			return errClient
+		}
+		noreply := len(args) == 6 && args[5] == "noreply"
+		s.cmdSet.Add(1)
+
+		reply := "STORED"
+		g, key, ok := s.resolve(args[1])
+		switch {
+		case !ok:
+			reply = "NOT_STORED"
+		case args[0] == "add" && peeked(g, key):
+			reply = "NOT_STORED"
+		default:
+			if err := g.Set(key, data[:size]); err != nil {
+				reply = "SERVER_ERROR " + err.Error()
+			}
+		}
+		if !noreply {
+			fmt.Fprintf(w, "%s\r\n", reply)
+		}
+	case "delete":
+		if len(args) < 2 || len(args) > 3 {
+			return errClient
+		}
+		reply := "NOT_FOUND"
+		if g, key, ok := s.resolve(args[1]); ok && g.Remove(key) {
+			reply = "DELETED"
+		}
+		if args[len(args)-1] != "noreply" {
+			fmt.Fprintf(w, "%s\r\n", reply)
+		}
+	case "touch":
+		// 没有过期时间，touch 只检查 key 是否在缓存中
+		if len(args) < 3 || len(args) > 4 {
+			return errClient
+		}
+		reply := "NOT_FOUND"
+		if g, key, ok := s.resolve(args[1]); ok && peeked(g, key) {
+			reply = "TOUCHED"
+		}
+		if args[len(args)-1] != "noreply" {
+			fmt.Fprintf(w, "%s\r\n", reply)
+		}
+	case "stats":
+		s.writeStats(w)
+	case "version":
+		fmt.Fprint(w, "VERSION fatcache\r\n")
+	default:
+		fmt.Fprint(w, "ERROR\r\n")
+	}
+	return nil
+}
+
+// readLine 读取一行，超过 maxLineLen 时返回 errLineTooLong
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineLen {
+			return "", errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return string(line), nil
+	}
+}
+
+func peeked(g *fatcache.Group, key string) bool {
+	_, ok := g.Peek(key)
+	return ok
+}
+
+// resolve 根据 key 前缀确定 Group，没有前缀时使用 Default
+func (s *Server) resolve(key string) (*fatcache.Group, string, bool) {
+	if name, k, ok := strings.Cut(key, ":"); ok {
+		if g := s.Lookup(name); g != nil {
+			return g, k, true
+		}
+	}
+	if s.Default != nil {
+		return s.Default, key, true
+	}
+	return nil, "", false
+}
+
+// casUnique 由 value 的哈希得到，value 不变时 cas 值不变
+func casUnique(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+func (s *Server) writeStats(w *bufio.Writer) {
+	stat := func(name string, v int64) {
+		fmt.Fprintf(w, "STAT %s %d\r\n", name, v)
+	}
+	stat("curr_connections", s.currConns.Load())
+	stat("total_connections", s.totalConns.Load())
+	stat("cmd_get", s.cmdGet.Load())
+	stat("cmd_set", s.cmdSet.Load())
+	stat("get_hits", s.getHits.Load())
+	stat("get_misses", s.getMisses.Load())
+	if s.Default != nil {
+		st := s.Default.Stats()
+		stat("group_gets", st.Gets)
+		stat("group_cache_hits", st.CacheHits)
+		stat("group_peer_loads", st.PeerLoads)
+		stat("group_local_loads", st.LocalLoads)
+	}
+	fmt.Fprint(w, "END\r\n")
+}
@@ -0,0 +1,156 @@
+package memcache
+
+import (
+	"bufio"
+	"fatcache"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// do 发送一条命令，读取回复直到 END 或单行结果
+func (c *client) do(t *testing.T, cmd string) string {
+	t.Helper()
+	fmt.Fprint(c.conn, cmd)
+	var lines []string
+	for {
+		line := c.readLine(t)
+		lines = append(lines, line)
+		switch {
+		case strings.HasPrefix(line, "VALUE "):
+			lines = append(lines, c.readLine(t))
+		case strings.HasPrefix(line, "STAT "):
+		default:
+			return strings.Join(lines, "|")
+		}
+	}
+}
+
+func (c *client) readLine(t *testing.T) string {
+	t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func startServer(t *testing.T, def *fatcache.Group, lookup func(string) *fatcache.Group) *client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(lookup, def)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func TestMemcacheCommands(t *testing.T) {
+	node := fatcache.NewNode()
+	g := node.NewGroup("users", 1024, fatcache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("not found")
+		}
+		return []byte("user " + key), nil
+	}))
+	c := startServer(t, g, node.GetGroup)
+
+	cases := []struct {
+		cmd    string
+		expect string
+	}{
+		{"get 1\r\n", "VALUE 1 0 6|user 1|END"},
+		{"get users:2 missing\r\n", "VALUE users:2 0 6|user 2|END"},
+		{"set 3 0 0 3\r\nbob\r\n", "STORED"},
+		{"get 3\r\n", "VALUE 3 0 3|bob|END"},
+		{"add 3 0 0 3\r\namy\r\n", "NOT_STORED"},
+		{"add 4 0 0 3\r\namy\r\n", "STORED"},
+		{"touch 4 100\r\n", "TOUCHED"},
+		{"touch 5 100\r\n", "NOT_FOUND"},
+		{"delete 4\r\n", "DELETED"},
+		{"delete 4\r\n", "NOT_FOUND"},
+		{"set 6 0 0 3 noreply\r\nabc\r\nget 6\r\n", "VALUE 6 0 3|abc|END"},
+		{"flush_all\r\n", "ERROR"},
+	}
+	for _, tc := range cases {
+		if got := c.do(t, tc.cmd); got != tc.expect {
+			t.Fatalf("%q: expected %q, got %q", tc.cmd, tc.expect, got)
+		}
+	}
+
+	gets := c.do(t, "gets 3\r\n")
+	if !strings.HasPrefix(gets, "VALUE 3 0 3 ") || gets != c.do(t, "gets 3\r\n") {
+		t.Fatalf("expected stable cas unique, got %q", gets)
+	}
+	if stats := c.do(t, "stats\r\n"); !strings.Contains(stats, "STAT cmd_set 4") {
+		t.Fatalf("unexpected stats: %q", stats)
+	}
+}
+
+func TestMemcacheLimits(t *testing.T) {
+	node := fatcache.NewNode()
+	g := node.NewGroup("users", 1024, nil)
+
+	c := startServer(t, g, node.GetGroup)
+	big := strings.Repeat("x", maxValueLen+1)
+	// 过大的数据块被跳过，之后的命令正常处理
+	if got := c.do(t, fmt.Sprintf("set 1 0 0 %d\r\n%s\r\nset 2 0 0 3\r\nbob\r\n", len(big), big)); got != "SERVER_ERROR object too large for cache" {
+		t.Fatalf("expected oversized value to be rejected, got %q", got)
+	}
+	if got := c.readLine(t); got != "STORED" {
+		t.Fatalf("expected the next command to be processed, got %q", got)
+	}
+
+	// 长度无法解析时关闭连接，不把数据块当作命令执行
+	c = startServer(t, g, node.GetGroup)
+	if got := c.do(t, "set 7 0 0 x\r\ndelete 2\r\n"); got != "CLIENT_ERROR bad command line format" {
+		t.Fatalf("expected bad set to be rejected, got %q", got)
+	}
+	if _, err := c.r.ReadString('\n'); err == nil {
+		t.Fatalf("expected connection to be closed after a bad set")
+	}
+	if _, ok := g.Peek("2"); !ok {
+		t.Fatalf("expected data block of a bad set not to be executed")
+	}
+
+	c = startServer(t, g, node.GetGroup)
+	go fmt.Fprintf(c.conn, "get %s\r\n", strings.Repeat("x", maxLineLen))
+	if got := c.readLine(t); got != "CLIENT_ERROR line too long" {
+		t.Fatalf("expected oversized line to be rejected, got %q", got)
+	}
+}
+
+func TestMemcacheLoadsThroughOwner(t *testing.T) {
+	cluster := fatcache.NewSimCluster(3, 1, "users", 1<<20, func(node, key string) ([]byte, error) {
+		return []byte(node), nil
+	})
+	owner := cluster.Owner("k")
+	var front *fatcache.SimNode
+	for _, n := range cluster.Nodes {
+		if n != owner {
+			front = n
+		}
+	}
+	c := startServer(t, front.Group, front.Node.GetGroup)
+
+	expect := fmt.Sprintf("VALUE k 0 %d|%s|END", len(owner.Name), owner.Name)
+	if got := c.do(t, "get k\r\n"); got != expect {
+		t.Fatalf("expected value loaded by owner, got %q", got)
+	}
+	if front.Loads() != 0 || owner.Loads() != 1 {
+		t.Fatalf("unexpected loads: %v", cluster.Loads())
+	}
+}
@@ -0,0 +1,260 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fatcache/consisitenthash"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrPeerUnreachable 表示内存网络中的目标节点因分区或丢包不可达
+var ErrPeerUnreachable = errors.New("fatcache: peer unreachable")
+
+type memoryLink struct {
+	from, to string
+}
+
+// MemoryNetwork 是进程内的节点网络，节点之间直接调用对方的 Group，
+// 可以注入延迟、丢包和网络分区，用于不依赖 socket 的确定性集群测试
+type MemoryNetwork struct {
+	mu          sync.Mutex
+	nodes       map[string]*Node
+	latency     time.Duration
+	linkLatency map[memoryLink]time.Duration
+	loss        float64
+	rand        *rand.Rand
+	partitioned map[memoryLink]bool
+}
+
+// NewMemoryNetwork 创建内存网络，seed 决定丢包的随机序列
+func NewMemoryNetwork(seed int64) *MemoryNetwork {
+	return &MemoryNetwork{
+		nodes:       make(map[string]*Node),
+		linkLatency: make(map[memoryLink]time.Duration),
+		rand:        rand.New(rand.NewSource(seed)),
+		partitioned: make(map[memoryLink]bool),
+	}
+}
+
+// Join 把 node 以 name 加入网络，返回该节点使用的 MemoryPool 并注册为 node 的 PeerPicker
+func (n *MemoryNetwork) Join(name string, node *Node) *MemoryPool {
+	n.mu.Lock()
+	n.nodes[name] = node
+	n.mu.Unlock()
+
+	p := &MemoryPool{
+		net:     n,
+		self:    name,
+		peers:   consisitenthash.New(defaultReplicas, nil),
+		getters: make(map[string]*memoryGetter),
+	}
+	node.RegisterPeers(p)
+	return p
+}
+
+// SetLatency 设置所有链路的默认单向延迟
+func (n *MemoryNetwork) SetLatency(d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.latency = d
+}
+
+// SetLinkLatency 设置 from 到 to 的链路延迟，覆盖默认延迟
+func (n *MemoryNetwork) SetLinkLatency(from, to string, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.linkLatency[memoryLink{from, to}] = d
+}
+
+// SetLoss 设置请求丢失的概率，取值范围 [0, 1]
+func (n *MemoryNetwork) SetLoss(p float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.loss = p
+}
+
+// Partition 切断 a 与 b 两组节点之间的双向通信
+func (n *MemoryNetwork) Partition(a, b []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, x := range a {
+		for _, y := range b {
+			n.partitioned[memoryLink{x, y}] = true
+			n.partitioned[memoryLink{y, x}] = true
+		}
+	}
+}
+
+// Heal 恢复所有被分区的链路
+func (n *MemoryNetwork) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.partitioned = make(map[memoryLink]bool)
+}
+
+// route 返回请求从 from 发往 to 的延迟和目标节点，不可达时返回错误
+func (n *MemoryNetwork) route(from, to string) (time.Duration, *Node, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	node, ok := n.nodes[to]
+	if !ok || n.partitioned[memoryLink{from, to}] {
+		return 0, nil, ErrPeerUnreachable
+	}
+	if n.loss > 0 && n.rand.Float64() < n.loss {
+		return 0, nil, ErrPeerUnreachable
+	}
+	d, ok := n.linkLatency[memoryLink{from, to}]
+	if !ok {
+		d = n.latency
+	}
+	return d, node, nil
+}
+
+// MemoryPool 是 MemoryNetwork 上的 PeerPicker，与 HTTPPool 一样用一致性哈希选择节点
+type MemoryPool struct {
+	net     *MemoryNetwork
+	self    string
+	mu      sync.Mutex
+	peers   *consisitenthash.Map
+	getters map[string]*memoryGetter
+}
+
+// Set 添加集群中的节点名，应包含自身
+func (p *MemoryPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.peers.Add(peers...)
+	for _, peer := range peers {
+		p.getters[peer] = &memoryGetter{net: p.net, from: p.self, to: peer}
+	}
+}
+
+func (p *MemoryPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peer := p.peers.Get(key)
+	if peer == "" || peer == p.self {
+		return nil, false
+	}
+	return p.getters[peer], true
+}
+
+func (p *MemoryPool) PickPeers(key string, n int) []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var getters []PeerGetter
+	for _, peer := range p.peers.GetN(key, n+1) {
+		if peer != p.self && len(getters) < n {
+			getters = append(getters, p.getters[peer])
+		}
+	}
+	return getters
+}
+
+// Peers 返回除自身以外的所有节点
+func (p *MemoryPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, 0, len(p.getters))
+	for name := range p.getters {
+		if name != p.self {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	getters := make([]PeerGetter, len(names))
+	for i, name := range names {
+		getters[i] = p.getters[name]
+	}
+	return getters
+}
+
+// Owner 返回负责 key 的节点名
+func (p *MemoryPool) Owner(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peers.Get(key)
+}
+
+var (
+	_ PeerPicker     = (*MemoryPool)(nil)
+	_ PeerListPicker = (*MemoryPool)(nil)
+	_ PeerLister     = (*MemoryPool)(nil)
+)
+
+type memoryGetter struct {
+	net      *MemoryNetwork
+	from, to string
+}
+
+func (m *memoryGetter) Get(group string, key string) ([]byte, error) {
+	return m.GetContext(context.Background(), group, key)
+}
+
+func (m *memoryGetter) GetContext(ctx context.Context, group string, key string) ([]byte, error) {
+	latency, node, err := m.net.route(m.from, m.to)
+	if err != nil {
+		return nil, err
+	}
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	g := node.GetGroup(group)
+	if g == nil {
+		return nil, errors.New("no such group: " + group)
+	}
+	// 与 HTTPPool 相同，双方交换代数，被转发的请求在目标节点本地加载
+	if hint := peerHintFrom(ctx); hint != nil {
+		g.observeGeneration(hint.sent)
+		hint.observe(g.Generation())
+	}
+	value, err := g.GetContext(withForwarded(ctx), key)
+	if err != nil {
+		if errors.Is(err, ErrOverloaded) {
+			return nil, err
+		}
+		return nil, &remoteError{err}
+	}
+	if hint := peerHintFrom(ctx); hint != nil {
+		hint.setTags(g.Tags(key))
+	}
+	return value.ByteSlice(), nil
+}
+
+// SetGeneration 把目标节点上 group 的代数跟进到 gen
+func (m *memoryGetter) SetGeneration(ctx context.Context, group string, gen uint64) error {
+	_, node, err := m.net.route(m.from, m.to)
+	if err != nil {
+		return err
+	}
+	if g := node.GetGroup(group); g != nil {
+		g.observeGeneration(gen)
+	}
+	return nil
+}
+
+// InvalidateTag 删除目标节点上 group 中带有 tag 的数据
+func (m *memoryGetter) InvalidateTag(ctx context.Context, group string, tag string) error {
+	_, node, err := m.net.route(m.from, m.to)
+	if err != nil {
+		return err
+	}
+	if g := node.GetGroup(group); g != nil {
+		g.invalidateTagLocally(tag)
+	}
+	return nil
+}
+
+var (
+	_ ContextPeerGetter = (*memoryGetter)(nil)
+	_ GenerationPeer    = (*memoryGetter)(nil)
+	_ TagInvalidator    = (*memoryGetter)(nil)
+)
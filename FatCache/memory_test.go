@@ -0,0 +1,106 @@
+package fatcache
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func simLoad(node, key string) ([]byte, error) {
+	return []byte(node + ":" + key), nil
+}
+
+func TestSimClusterLoadsOnce(t *testing.T) {
+	c := NewSimCluster(4, 1, "sim", 1<<20, simLoad)
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key%d", i)
+		for n := range c.Nodes {
+			value, err := c.Get(n, key)
+			if err != nil {
+				t.Fatalf("Error getting %s: %v", key, err)
+			}
+			if expected := c.Owner(key).Name + ":" + key; value.String() != expected {
+				t.Fatalf("expected %s, got %s", expected, value.String())
+			}
+		}
+	}
+	if total := c.TotalLoads(); total != 50 {
+		t.Fatalf("expected 50 loads across the cluster, got %d", total)
+	}
+}
+
+func TestSimClusterPartitionFailover(t *testing.T) {
+	c := NewSimCluster(3, 1, "sim", 1<<20, simLoad)
+	key := "key"
+	owner := c.Owner(key)
+	var reader *SimNode
+	for _, n := range c.Nodes {
+		if n != owner {
+			reader = n
+			break
+		}
+	}
+
+	c.Network.Partition([]string{reader.Name}, []string{owner.Name})
+	value, err := reader.Group.Get(key)
+	if err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if value.String() != reader.Name+":"+key {
+		t.Fatalf("expected partitioned reader to load locally, got %s", value.String())
+	}
+	if owner.Loads() != 0 || reader.Loads() != 1 {
+		t.Fatalf("unexpected loads: %v", c.Loads())
+	}
+
+	c.Network.Heal()
+	if _, err := reader.Group.Get("other"); err != nil {
+		t.Fatalf("Error getting value after heal: %v", err)
+	}
+}
+
+func TestSimClusterLossDeterministic(t *testing.T) {
+	run := func() map[string]int64 {
+		c := NewSimCluster(4, 42, "sim", 1<<20, simLoad)
+		c.Network.SetLoss(0.5)
+		for i := 0; i < 100; i++ {
+			c.Get(0, fmt.Sprintf("key%d", i))
+		}
+		return c.Loads()
+	}
+
+	first, second := run(), run()
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("expected identical load counts for the same seed, got %v and %v", first, second)
+	}
+	if first["node0"] == 0 {
+		t.Fatalf("expected lost requests to fall back to local loads, got %v", first)
+	}
+}
+
+func TestSimClusterLatencyHedge(t *testing.T) {
+	c := NewSimCluster(3, 1, "sim", 1<<20, simLoad,
+		WithPeerPolicy(PeerPolicy{HedgeAfter: 10 * time.Millisecond}))
+	key := "key"
+	owner := c.Owner(key)
+	var reader *SimNode
+	for _, n := range c.Nodes {
+		if n != owner {
+			reader = n
+			break
+		}
+	}
+	c.Network.SetLinkLatency(reader.Name, owner.Name, time.Second)
+
+	start := time.Now()
+	if _, err := reader.Group.Get(key); err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected hedged request to avoid the slow link, took %v", elapsed)
+	}
+	if reader.Group.Stats().PeerHedges != 1 {
+		t.Fatalf("expected one hedged request")
+	}
+}
@@ -0,0 +1,91 @@
+package fatcache
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Node 持有一组 Group 及为它们服务的节点池，
+// 同一进程内可以创建多个互不影响的 Node，例如在测试中模拟多节点集群
+type Node struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+	peers  *PeerPicker
+	events *eventLog
+}
+
+// defaultNode 是包级 NewGroup、GetGroup 和 NewHTTPPool 使用的默认实例
+var defaultNode = NewNode()
+
+func NewNode() *Node {
+	return &Node{groups: make(map[string]*Group)}
+}
+
+// NewGroup 在 Node 上创建 Group，同名 Group 已存在时 panic；
+// Node 已注册节点池时新 Group 会自动使用它
+func (n *Node) NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
+	g, ok := n.addGroup(name, cacheBytes, getter, opts, false)
+	if !ok {
+		panic(fmt.Sprintf("fatcache: duplicate registration of group %s", name))
+	}
+	return g
+}
+
+// addGroup 创建并注册 Group，replace 为 false 且同名 Group 已存在时返回 false
+func (n *Node) addGroup(name string, cacheBytes int64, getter Getter, opts []GroupOption, replace bool) (*Group, bool) {
+	n.mu.Lock()
+	old, ok := n.groups[name]
+	if ok && !replace {
+		n.mu.Unlock()
+		return old, false
+	}
+
+	g := newGroup(name, cacheBytes, getter, opts)
+	if ok && old.mainCache.budget != nil {
+		old.mainCache.budget.release(&old.mainCache)
+	}
+	if n.peers != nil {
+		g.peers.CompareAndSwap(nil, n.peers)
+	}
+	if n.events != nil {
+		g.events.Store(n.events)
+	}
+	n.groups[name] = g
+	n.mu.Unlock()
+
+	// 被替换的 Group 写入写回队列中剩余的数据并停止后台写入，写入可能重试，因此不持有锁
+	if ok {
+		if err := old.Close(); err != nil {
+			old.log(LevelError, "flush of replaced group failed", F("err", err))
+		}
+	}
+	return g, true
+}
+
+// GetGroup 返回 Node 上名为 name 的 Group，不存在时返回 nil
+func (n *Node) GetGroup(name string) *Group {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.groups[name]
+}
+
+// RegisterPeers 为 Node 上已有及之后创建的 Group 设置 PeerPicker，
+// 通过 Group.RegisterPeerPicker 单独设置过的 Group 保持不变
+func (n *Node) RegisterPeers(p PeerPicker) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	old := n.peers
+	n.peers = &p
+	for _, g := range n.groups {
+		if !g.peers.CompareAndSwap(old, n.peers) {
+			g.peers.CompareAndSwap(nil, n.peers)
+		}
+	}
+}
+
+// NewHTTPPool 创建服务于该 Node 的 HTTPPool，并注册为 Node 的 PeerPicker
+func (n *Node) NewHTTPPool(self string, opts *HTTPPoolOptions) *HTTPPool {
+	p := newHTTPPool(n, self, opts)
+	n.RegisterPeers(p)
+	return p
+}
@@ -0,0 +1,125 @@
+package fatcache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+type testNode struct {
+	node   *Node
+	pool   *HTTPPool
+	group  *Group
+	addr   string
+	loads  int32
+	server *httptest.Server
+}
+
+// startTestCluster 在同一进程内启动 n 个各自独立的 Node，组成一个 HTTP 集群
+func startTestCluster(t *testing.T, n int) []*testNode {
+	t.Helper()
+	nodes := make([]*testNode, n)
+	addrs := make([]string, n)
+	for i := range nodes {
+		tn := &testNode{node: NewNode()}
+		tn.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tn.pool.ServeHTTP(w, r)
+		}))
+		tn.addr = tn.server.Listener.Addr().String()
+		addrs[i] = tn.addr
+		nodes[i] = tn
+	}
+	for _, tn := range nodes {
+		tn := tn
+		tn.pool = tn.node.NewHTTPPool(tn.addr, nil)
+		tn.pool.Set(addrs...)
+		tn.group = tn.node.NewGroup("scores", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			atomic.AddInt32(&tn.loads, 1)
+			return []byte(tn.addr + ":" + key), nil
+		}))
+		tn.server.Start()
+		t.Cleanup(tn.server.Close)
+	}
+	return nodes
+}
+
+func TestNodeIsolation(t *testing.T) {
+	a, b := NewNode(), NewNode()
+	ga := a.NewGroup("g", 1024, GetterFunc(func(key string) ([]byte, error) { return []byte("a"), nil }))
+	gb := b.NewGroup("g", 1024, GetterFunc(func(key string) ([]byte, error) { return []byte("b"), nil }))
+
+	if a.GetGroup("g") != ga || b.GetGroup("g") != gb {
+		t.Fatalf("expected each node to own its group")
+	}
+	if GetGroup("g") == ga || GetGroup("g") == gb {
+		t.Fatalf("node groups must not leak into the default node")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected duplicate group registration to panic")
+		}
+	}()
+	a.NewGroup("g", 1024, GetterFunc(func(key string) ([]byte, error) { return nil, nil }))
+}
+
+func TestRegisterPeersKeepsCustomPicker(t *testing.T) {
+	var loads int32
+	n := NewNode()
+	custom := &fakePicker{peers: []PeerGetter{&fakePeer{name: "custom"}}}
+	withCustom := n.NewGroup("custom", 1024, countingGetter(&loads))
+	withCustom.RegisterPeerPicker(custom)
+	plain := n.NewGroup("plain", 1024, countingGetter(&loads))
+
+	first := &fakePicker{peers: []PeerGetter{&fakePeer{name: "first"}}}
+	second := &fakePicker{peers: []PeerGetter{&fakePeer{name: "second"}}}
+	n.RegisterPeers(first)
+	if withCustom.peerPicker() != custom || plain.peerPicker() != first {
+		t.Fatalf("expected only groups without a picker to use the node's picker")
+	}
+
+	// 加载与替换节点池并发进行
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			plain.Get(fmt.Sprintf("key%d", i))
+		}
+	}()
+	n.RegisterPeers(second)
+	<-done
+	later := n.NewGroup("later", 1024, countingGetter(&loads))
+	if withCustom.peerPicker() != custom || plain.peerPicker() != second || later.peerPicker() != second {
+		t.Fatalf("expected node picker to be replaced without touching custom pickers")
+	}
+}
+
+func TestMultiNodeCluster(t *testing.T) {
+	nodes := startTestCluster(t, 3)
+
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key%d", i)
+		for _, tn := range nodes {
+			value, err := tn.group.Get(key)
+			if err != nil {
+				t.Fatalf("Error getting %s from %s: %v", key, tn.addr, err)
+			}
+			// 每个 key 都由其负责节点加载
+			owner := strings.SplitN(value.String(), ":"+key, 2)[0]
+			if owner != nodes[0].pool.peers.Get(key) {
+				t.Fatalf("key %s loaded by %s, expected owner %s", key, owner, nodes[0].pool.peers.Get(key))
+			}
+		}
+	}
+
+	var total int32
+	for _, tn := range nodes {
+		total += atomic.LoadInt32(&tn.loads)
+	}
+	if total != 30 {
+		t.Fatalf("expected each key to be loaded exactly once across the cluster, got %d loads", total)
+	}
+}
@@ -1,9 +1,37 @@
 package fatcache
 
+import "context"
+
 type PeerPicker interface {
 	PickPeer(key string) (PeerGetter, bool)
 }
 
+// PeerListPicker 是可选接口，按一致性哈希环顺序返回 key 的多个远端负责节点，
+// 用于向次级节点发起对冲请求
+type PeerListPicker interface {
+	PickPeers(key string, n int) []PeerGetter
+}
+
 type PeerGetter interface {
 	Get(group string, key string) ([]byte, error)
 }
+
+// ContextPeerGetter 是可选接口，实现后调用方的取消和超时会传递给远端请求
+type ContextPeerGetter interface {
+	PeerGetter
+	GetContext(ctx context.Context, group string, key string) ([]byte, error)
+}
+
+type peerStatser interface {
+	PeerStats() map[string]PeerStats
+}
+
+// PeerLister 是可选接口，返回集群中除自身以外的所有远端节点，用于向整个集群广播
+type PeerLister interface {
+	Peers() []PeerGetter
+}
+
+// GenerationPeer 是可选接口，实现后 Group.BumpGeneration 会把新的代数同步给远端节点
+type GenerationPeer interface {
+	SetGeneration(ctx context.Context, group string, gen uint64) error
+}
@@ -0,0 +1,202 @@
+package fatcache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePeer 在前 failures 次请求时返回错误，delay 模拟网络延迟
+type fakePeer struct {
+	name     string
+	failures int32
+	delay    time.Duration
+	calls    int32
+}
+
+func (p *fakePeer) Get(group string, key string) ([]byte, error) {
+	n := atomic.AddInt32(&p.calls, 1)
+	time.Sleep(p.delay)
+	if n <= atomic.LoadInt32(&p.failures) {
+		return nil, errors.New("peer blip")
+	}
+	return []byte(p.name + ":" + key), nil
+}
+
+type fakePicker struct {
+	peers []PeerGetter
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	return p.peers[0], true
+}
+
+func (p *fakePicker) PickPeers(key string, n int) []PeerGetter {
+	if n > len(p.peers) {
+		n = len(p.peers)
+	}
+	return p.peers[:n]
+}
+
+func countingGetter(loads *int32) GetterFunc {
+	return func(key string) ([]byte, error) {
+		atomic.AddInt32(loads, 1)
+		return []byte("local:" + key), nil
+	}
+}
+
+func TestPeerRetry(t *testing.T) {
+	var loads int32
+	peer := &fakePeer{name: "peer", failures: 2}
+	group := NewGroup("retryGroup", 1024, countingGetter(&loads),
+		WithPeerPolicy(PeerPolicy{Retries: 2, Backoff: time.Millisecond}))
+	group.RegisterPeerPicker(&fakePicker{peers: []PeerGetter{peer}})
+
+	value, err := group.Get("key")
+	if err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if value.String() != "peer:key" {
+		t.Fatalf("expected value from peer after retries, got %s", value.String())
+	}
+	if loads != 0 {
+		t.Fatalf("expected no local loads, got %d", loads)
+	}
+	if stats := group.Stats(); stats.PeerRetries != 2 || stats.PeerLoads != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestPeerRetryExhausted(t *testing.T) {
+	var loads int32
+	peer := &fakePeer{name: "peer", failures: 10}
+	group := NewGroup("retryGroup", 1024, countingGetter(&loads),
+		WithPeerPolicy(PeerPolicy{Retries: 1}))
+	group.RegisterPeerPicker(&fakePicker{peers: []PeerGetter{peer}})
+
+	value, err := group.Get("key")
+	if err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if value.String() != "local:key" || loads != 1 {
+		t.Fatalf("expected fallback to local getter, got %s", value.String())
+	}
+	if atomic.LoadInt32(&peer.calls) != 2 {
+		t.Fatalf("expected 2 peer calls, got %d", peer.calls)
+	}
+}
+
+func TestHedgedRequest(t *testing.T) {
+	var loads int32
+	slow := &fakePeer{name: "slow", delay: 500 * time.Millisecond}
+	fast := &fakePeer{name: "fast"}
+	group := NewGroup("hedgeGroup", 1024, countingGetter(&loads),
+		WithPeerPolicy(PeerPolicy{HedgeAfter: 20 * time.Millisecond}))
+	group.RegisterPeerPicker(&fakePicker{peers: []PeerGetter{slow, fast}})
+
+	start := time.Now()
+	value, err := group.Get("key")
+	if err != nil {
+		t.Fatalf("Error getting value: %v", err)
+	}
+	if value.String() != "fast:key" {
+		t.Fatalf("expected hedged value from secondary, got %s", value.String())
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Fatalf("hedged request took too long: %v", elapsed)
+	}
+	if group.Stats().PeerHedges != 1 {
+		t.Fatalf("expected one hedged request, got %d", group.Stats().PeerHedges)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() {
+		t.Fatalf("breaker should stay closed below threshold")
+	}
+	b.failure()
+	if b.allow() {
+		t.Fatalf("breaker should be open after threshold")
+	}
+
+	now = now.Add(time.Second)
+	if !b.allow() {
+		t.Fatalf("breaker should let a probe through when half-open")
+	}
+	if b.allow() {
+		t.Fatalf("breaker should allow only one probe when half-open")
+	}
+	b.success()
+	if state, _ := b.snapshot(); state != BreakerClosed {
+		t.Fatalf("expected closed breaker after successful probe, got %v", state)
+	}
+}
+
+func TestHTTPPoolBreakerStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{
+		Breaker: BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute},
+	})
+	pool.Set(addr)
+	peer, _ := pool.PickPeer("key")
+
+	for i := 0; i < 2; i++ {
+		if _, err := peer.Get("g", "key"); err == nil {
+			t.Fatalf("expected error from unavailable peer")
+		}
+	}
+	if _, err := peer.Get("g", "key"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+
+	var loads int32
+	group := NewGroup("breakerGroup", 1024, countingGetter(&loads))
+	group.RegisterPeerPicker(pool)
+	if state := group.Stats().Peers[addr].Breaker; state != "open" {
+		t.Fatalf("expected open breaker in stats, got %q", state)
+	}
+}
+
+func TestMissingKeyNotRetried(t *testing.T) {
+	var loads atomic.Int32
+	nodes := startTestCluster(t, 3)
+	for _, tn := range nodes {
+		tn.node.NewGroup("missing", 1024, GetterFunc(func(key string) ([]byte, error) {
+			loads.Add(1)
+			return nil, errors.New("not found")
+		}), WithPeerPolicy(PeerPolicy{Retries: 3, Backoff: time.Millisecond, HedgeAfter: time.Millisecond}))
+	}
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if _, remote := nodes[0].pool.PickPeer(key); remote {
+			break
+		}
+	}
+
+	// 远端 Getter 的错误不是节点故障，不重试、不对冲，也不在本地再加载一次
+	if _, err := nodes[0].node.GetGroup("missing").Get(key); err == nil {
+		t.Fatalf("expected error for missing key")
+	}
+	if n := loads.Load(); n != 1 {
+		t.Fatalf("expected exactly one backend load for a missing key, got %d", n)
+	}
+	if stats := nodes[0].node.GetGroup("missing").Stats(); stats.PeerRetries != 0 || stats.PeerHedges != 0 {
+		t.Fatalf("unexpected retries or hedges: %+v", stats)
+	}
+}
@@ -0,0 +1,120 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultMaxBulkLen 为 Server.MaxBulkLen 的默认值
+	defaultMaxBulkLen = 1 << 20
+	// maxArgs 为一条命令的参数数量上限，maxLineLen 为一行的长度上限，与 Redis 一致
+	maxArgs    = 1 << 20
+	maxLineLen = 64 << 10
+)
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand 读取一条命令，支持 RESP 数组格式和 telnet 使用的内联格式，
+// 单个参数超过 maxBulk 字节时返回 errProtocol
+func readCommand(r *bufio.Reader, maxBulk int) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, errProtocol
+	}
+	// 参数数量来自客户端，不按 n 预先分配
+	var args []string
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, errProtocol
+		}
+		// 长度同样来自客户端，缓冲区随实际读到的数据增长
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r, int64(size)+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		b := buf.Bytes()
+		if b[size] != '\r' || b[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+// readLine 读取一行，超过 maxLineLen 时返回 errProtocol
+func readLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > maxLineLen {
+			return "", errProtocol
+		}
+		line = append(line, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(line), "\r\n"), nil
+	}
+}
+
+// writer 按 RESP 格式写回复
+type writer struct {
+	w *bufio.Writer
+}
+
+func (w writer) simple(s string) {
+	fmt.Fprintf(w.w, "+%s\r\n", s)
+}
+
+func (w writer) error(s string) {
+	fmt.Fprintf(w.w, "-%s\r\n", s)
+}
+
+func (w writer) integer(n int64) {
+	fmt.Fprintf(w.w, ":%d\r\n", n)
+}
+
+func (w writer) bulk(b []byte) {
+	fmt.Fprintf(w.w, "$%d\r\n", len(b))
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w writer) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w writer) array(n int) {
+	fmt.Fprintf(w.w, "*%d\r\n", n)
+}
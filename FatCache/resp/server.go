@@ -0,0 +1,279 @@
+// Package resp 为 fatcache 提供 Redis RESP 协议的访问入口，
+// 现有的 Redis 客户端可以直接通过它读取集群中的数据
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fatcache"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Server 把 Redis 命令映射到 fatcache 的 Group 上。
+//
+// 连接通过 SELECT <group> 选择 Group 后，key 直接对应 Group 中的 key；
+// 未选择时 key 必须带有 "<group>:" 前缀。
+type Server struct {
+	// Lookup 按名称查找 Group，默认为 fatcache.GetGroup
+	Lookup func(name string) *fatcache.Group
+	// MaxBulkLen 为命令中单个参数的最大字节数，超过时返回错误并关闭连接，默认 1MiB
+	MaxBulkLen int
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+func NewServer(lookup func(name string) *fatcache.Group) *Server {
+	if lookup == nil {
+		lookup = fatcache.GetGroup
+	}
+	return &Server{Lookup: lookup, conns: make(map[net.Conn]struct{})}
+}
+
+// ListenAndServe 监听 addr 并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 在 l 上接受连接，直到 Close 被调用
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(conn)
+	}
+}
+
+// Close 关闭监听和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+type session struct {
+	group *fatcache.Group
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := writer{bufio.NewWriter(conn)}
+	sess := &session{}
+	maxBulk := s.MaxBulkLen
+	if maxBulk <= 0 {
+		maxBulk = defaultMaxBulkLen
+	}
+	for {
+		args, err := readCommand(r, maxBulk)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.error("ERR " + err.Error())
+				w.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if strings.ToUpper(args[0]) == "QUIT" {
+			w.simple("OK")
+			w.w.Flush()
+			return
+		}
+		s.dispatch(sess, w, args)
+		// 客户端使用 pipeline 时，等缓冲区中的命令处理完再统一写回
+		if r.Buffered() == 0 {
+			if err := w.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// arity 为命令的参数个数，负数表示至少需要的参数个数
+var arity = map[string]int{
+	"ECHO": 1, "SELECT": 1, "GET": 1, "SET": 2, "TTL": 1,
+	"DEL": -1, "MGET": -1, "EXISTS": -1,
+}
+
+func (s *Server) dispatch(sess *session, w writer, args []string) {
+	cmd := strings.ToUpper(args[0])
+	argc := len(args) - 1
+	if n, ok := arity[cmd]; ok && (n >= 0 && argc != n || n < 0 && argc < -n) {
+		w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd)))
+		return
+	}
+
+	switch cmd {
+	case "PING":
+		if argc > 0 {
+			w.bulk([]byte(args[1]))
+			return
+		}
+		w.simple("PONG")
+	case "ECHO":
+		w.bulk([]byte(args[1]))
+	case "COMMAND":
+		// redis-cli 连接时会发送 COMMAND DOCS，返回空数组即可
+		w.array(0)
+	case "SELECT":
+		g := s.Lookup(args[1])
+		if g == nil {
+			w.error("ERR no such group: " + args[1])
+			return
+		}
+		sess.group = g
+		w.simple("OK")
+	case "GET":
+		g, key, err := s.resolve(sess, args[1])
+		if err != nil {
+			w.error(err.Error())
+			return
+		}
+		value, err := g.Get(key)
+		if err != nil {
+			getError(w, err)
+			return
+		}
+		w.bulk(value.ByteSlice())
+	case "MGET":
+		w.array(argc)
+		for _, arg := range args[1:] {
+			g, key, err := s.resolve(sess, arg)
+			if err != nil {
+				w.null()
+				continue
+			}
+			value, err := g.Get(key)
+			if err != nil {
+				getError(w, err)
+				continue
+			}
+			w.bulk(value.ByteSlice())
+		}
+	case "SET":
+		g, key, err := s.resolve(sess, args[1])
+		if err != nil {
+			w.error(err.Error())
+			return
+		}
+		if err := g.Set(key, []byte(args[2])); err != nil {
+			w.error("ERR " + err.Error())
+			return
+		}
+		w.simple("OK")
+	case "DEL":
+		var n int64
+		for _, arg := range args[1:] {
+			if g, key, err := s.resolve(sess, arg); err == nil && g.Remove(key) {
+				n++
+			}
+		}
+		w.integer(n)
+	case "EXISTS":
+		// 只检查本节点的缓存，不触发加载
+		var n int64
+		for _, arg := range args[1:] {
+			if g, key, err := s.resolve(sess, arg); err == nil {
+				if _, ok := g.Peek(key); ok {
+					n++
+				}
+			}
+		}
+		w.integer(n)
+	case "TTL":
+		// fatcache 中的数据没有过期时间，缓存中存在的 key 返回 -1，不存在返回 -2
+		g, key, err := s.resolve(sess, args[1])
+		if err != nil {
+			w.error(err.Error())
+			return
+		}
+		if _, ok := g.Peek(key); !ok {
+			w.integer(-2)
+			return
+		}
+		w.integer(-1)
+	case "INFO":
+		w.bulk([]byte(s.info(sess)))
+	default:
+		w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+// getError 回复 Get 的错误：Getter 的错误视为 key 不存在，返回 nil；
+// 负载限制、节点不可用等无法确定 key 是否存在的错误返回 -ERR
+func getError(w writer, err error) {
+	if fatcache.IsUnavailable(err) {
+		w.error("ERR " + err.Error())
+		return
+	}
+	w.null()
+}
+
+// resolve 根据会话选择的 Group 或 key 前缀确定 Group 和实际的 key
+func (s *Server) resolve(sess *session, key string) (*fatcache.Group, string, error) {
+	if sess.group != nil {
+		return sess.group, key, nil
+	}
+	name, k, ok := strings.Cut(key, ":")
+	if !ok {
+		return nil, "", errors.New("ERR key must be prefixed with '<group>:' or SELECT a group first")
+	}
+	g := s.Lookup(name)
+	if g == nil {
+		return nil, "", errors.New("ERR no such group: " + name)
+	}
+	return g, k, nil
+}
+
+func (s *Server) info(sess *session) string {
+	var b strings.Builder
+	b.WriteString("# Server\r\nfatcache_frontend:resp\r\n")
+	if sess.group == nil {
+		return b.String()
+	}
+	st := sess.group.Stats()
+	fmt.Fprintf(&b, "\r\n# Group\r\ngroup:%s\r\n", sess.group.Name())
+	fmt.Fprintf(&b, "gets:%d\r\ncache_hits:%d\r\n", st.Gets, st.CacheHits)
+	fmt.Fprintf(&b, "peer_loads:%d\r\npeer_errors:%d\r\n", st.PeerLoads, st.PeerErrors)
+	fmt.Fprintf(&b, "local_loads:%d\r\nlocal_load_errors:%d\r\n", st.LocalLoads, st.LocalLoadErrs)
+	return b.String()
+}
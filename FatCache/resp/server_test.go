@@ -0,0 +1,181 @@
+package resp
+
+import (
+	"bufio"
+	"fatcache"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) do(t *testing.T, args ...string) string {
+	t.Helper()
+	fmt.Fprintf(c.conn, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(c.conn, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return c.read(t)
+}
+
+// read 读取一条回复，数组按元素以空格拼接
+func (c *client) read(t *testing.T) string {
+	t.Helper()
+	line, err := readLine(c.r)
+	if err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	switch line[0] {
+	case '$':
+		if line == "$-1" {
+			return "(nil)"
+		}
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		buf := make([]byte, n+2)
+		io.ReadFull(c.r, buf)
+		return string(buf[:n])
+	case '*':
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.read(t)
+		}
+		return strings.Join(items, " ")
+	}
+	return line
+}
+
+func startServer(t *testing.T) *client {
+	t.Helper()
+	return startServerWith(t, func(*Server) {})
+}
+
+// startServerWith 与 startServer 相同，启动前用 configure 修改 Server 的配置
+func startServerWith(t *testing.T, configure func(*Server)) *client {
+	t.Helper()
+	node := fatcache.NewNode()
+	node.NewGroup("users", 1024, fatcache.GetterFunc(func(key string) ([]byte, error) {
+		if key == "missing" {
+			return nil, fmt.Errorf("not found")
+		}
+		return []byte("user " + key), nil
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(node.GetGroup)
+	configure(s)
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+func TestRESPCommands(t *testing.T) {
+	c := startServer(t)
+
+	cases := []struct {
+		args   []string
+		expect string
+	}{
+		{[]string{"PING"}, "+PONG"},
+		{[]string{"GET", "users:1"}, "user 1"},
+		{[]string{"GET", "nokey"}, "-ERR key must be prefixed with '<group>:' or SELECT a group first"},
+		{[]string{"GET", "users:missing"}, "(nil)"},
+		{[]string{"SET", "users:2", "bob"}, "+OK"},
+		{[]string{"MGET", "users:1", "users:2", "users:missing"}, "user 1 bob (nil)"},
+		{[]string{"EXISTS", "users:1", "users:missing"}, ":1"},
+		{[]string{"TTL", "users:1"}, ":-1"},
+		{[]string{"TTL", "users:missing"}, ":-2"},
+		// EXISTS 与 TTL 只查看缓存，不加载
+		{[]string{"EXISTS", "users:9"}, ":0"},
+		{[]string{"TTL", "users:9"}, ":-2"},
+		{[]string{"DEL", "users:2", "users:3"}, ":1"},
+		{[]string{"SELECT", "orders"}, "-ERR no such group: orders"},
+		{[]string{"SELECT", "users"}, "+OK"},
+		{[]string{"GET", "3"}, "user 3"},
+		{[]string{"SET", "k"}, "-ERR wrong number of arguments for 'set' command"},
+		{[]string{"FLUSHALL"}, "-ERR unknown command 'FLUSHALL'"},
+	}
+	for _, tc := range cases {
+		if got := c.do(t, tc.args...); got != tc.expect {
+			t.Fatalf("%v: expected %q, got %q", tc.args, tc.expect, got)
+		}
+	}
+
+	if info := c.do(t, "INFO"); !strings.Contains(info, "group:users") {
+		t.Fatalf("expected INFO to describe the selected group, got %q", info)
+	}
+}
+
+func TestRESPUnavailable(t *testing.T) {
+	c := startServerWith(t, func(s *Server) {
+		node := fatcache.NewNode()
+		node.NewGroup("limited", 1024, fatcache.GetterFunc(func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), fatcache.WithLoadLimits(fatcache.LoadLimits{Rate: 0.001, MaxWait: time.Millisecond}))
+		s.Lookup = node.GetGroup
+	})
+	if got := c.do(t, "GET", "limited:a"); got != "a" {
+		t.Fatalf("expected first load to succeed, got %q", got)
+	}
+	// 超出负载限制时无法确定 key 是否存在，不能返回 nil
+	if got := c.do(t, "GET", "limited:b"); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("expected overloaded GET to return an error, got %q", got)
+	}
+	if got := c.do(t, "MGET", "limited:a", "limited:c"); !strings.HasPrefix(got, "a -ERR") {
+		t.Fatalf("expected overloaded MGET entry to return an error, got %q", got)
+	}
+}
+
+func TestRESPInlineCommand(t *testing.T) {
+	c := startServer(t)
+	fmt.Fprintf(c.conn, "GET users:7\r\n")
+	if got := c.read(t); got != "user 7" {
+		t.Fatalf("expected inline GET to work, got %q", got)
+	}
+}
+
+func TestRESPLimits(t *testing.T) {
+	c := startServer(t)
+	fmt.Fprintf(c.conn, "*99999999999\r\n")
+	if got := c.read(t); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("expected oversized array to be rejected, got %q", got)
+	}
+
+	c = startServer(t)
+	go fmt.Fprintf(c.conn, "GET %s\r\n", strings.Repeat("x", maxLineLen))
+	if got := c.read(t); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("expected oversized inline command to be rejected, got %q", got)
+	}
+
+	c = startServerWith(t, func(s *Server) { s.MaxBulkLen = 8 })
+	if got := c.do(t, "SET", "users:7", "12345678"); got != "+OK" {
+		t.Fatalf("expected value at the limit to be accepted, got %q", got)
+	}
+	if got := c.do(t, "SET", "users:7", "123456789"); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("expected oversized bulk string to be rejected, got %q", got)
+	}
+
+	// 默认上限拒绝声明过大的参数，不等待数据到达
+	c = startServer(t)
+	fmt.Fprintf(c.conn, "*1\r\n$%d\r\n", defaultMaxBulkLen+1)
+	if got := c.read(t); !strings.HasPrefix(got, "-ERR") {
+		t.Fatalf("expected bulk string above the default limit to be rejected, got %q", got)
+	}
+}
@@ -0,0 +1,162 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PeerPolicy 配置从远端节点加载数据时的重试与对冲策略
+type PeerPolicy struct {
+	// Retries 首次请求失败后的最大重试次数
+	Retries int
+	// Backoff 第一次重试前的等待时间，之后每次翻倍
+	Backoff time.Duration
+	// MaxBackoff 重试等待时间的上限，0 表示不限制
+	MaxBackoff time.Duration
+	// HedgeAfter 主节点超过该时间未返回时，向环上的次级节点发起对冲请求，0 表示不对冲
+	HedgeAfter time.Duration
+}
+
+// WithPeerPolicy 设置 Group 访问远端节点的重试与对冲策略
+func WithPeerPolicy(p PeerPolicy) GroupOption {
+	return func(g *Group) {
+		g.peerPolicy = p
+	}
+}
+
+// getFromPeers 按 PeerPolicy 向 key 的负责节点请求数据，节点不可用时退避重试；
+// 远端 Getter 返回的错误说明节点可用，直接返回，避免放大后端的负载
+func (g *Group) getFromPeers(ctx context.Context, primary PeerGetter, key string) (ByteView, error) {
+	policy := g.peerPolicy
+	secondary := g.secondaryPeer(primary, key)
+	backoff := policy.Backoff
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var value ByteView
+		value, err = g.hedgedGet(ctx, primary, secondary, key)
+		if err == nil {
+			return value, nil
+		}
+		if attempt >= policy.Retries || ctx.Err() != nil || !isPeerFailure(err) {
+			break
+		}
+		// 熔断器打开且没有可对冲的次级节点时，重试没有意义
+		if errors.Is(err, ErrCircuitOpen) && secondary == nil {
+			break
+		}
+
+		g.stats.peerRetries.Add(1)
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ByteView{}, ctx.Err()
+			}
+			backoff *= 2
+			if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+				backoff = policy.MaxBackoff
+			}
+		}
+	}
+	return ByteView{}, err
+}
+
+// secondaryPeer 返回环上 key 的次级远端负责节点，不对冲时返回 nil
+func (g *Group) secondaryPeer(primary PeerGetter, key string) PeerGetter {
+	if g.peerPolicy.HedgeAfter <= 0 {
+		return nil
+	}
+	picker, ok := g.peerPicker().(PeerListPicker)
+	if !ok {
+		return nil
+	}
+	for _, peer := range picker.PickPeers(key, 2) {
+		if peer != primary {
+			return peer
+		}
+	}
+	return nil
+}
+
+type peerResult struct {
+	value ByteView
+	err   error
+}
+
+// hedgedGet 向主节点发起请求，若超过 HedgeAfter 未返回或因节点不可用提前失败，
+// 再向次级节点发起请求，返回最先成功的结果；远端 Getter 返回的错误直接返回
+func (g *Group) hedgedGet(ctx context.Context, primary, secondary PeerGetter, key string) (ByteView, error) {
+	if secondary == nil {
+		return g.getFromPeer(ctx, primary, key)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan peerResult, 2)
+	fetch := func(peer PeerGetter) {
+		value, err := g.getFromPeer(ctx, peer, key)
+		results <- peerResult{value, err}
+	}
+	go fetch(primary)
+
+	timer := time.NewTimer(g.peerPolicy.HedgeAfter)
+	defer timer.Stop()
+
+	inflight, hedged := 1, false
+	hedge := func() {
+		if !hedged {
+			hedged = true
+			inflight++
+			g.stats.peerHedges.Add(1)
+			go fetch(secondary)
+		}
+	}
+
+	var err error
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			hedge()
+		case r := <-results:
+			inflight--
+			if r.err == nil || !isPeerFailure(r.err) {
+				return r.value, r.err
+			}
+			err = r.err
+			hedge()
+		}
+	}
+	return ByteView{}, err
+}
+
+// remoteError 是远端节点的 Getter 返回的错误，节点本身可用
+type remoteError struct {
+	err error
+}
+
+func (e *remoteError) Error() string {
+	return e.err.Error()
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.err
+}
+
+// IsUnavailable 判断 Get 返回的错误是否表示数据暂时无法取得（超出负载限制、节点不可用、超时等），
+// 而不是 Getter 返回的错误。这类错误不能说明 key 不存在
+func IsUnavailable(err error) bool {
+	var re *remoteError
+	if errors.As(err, &re) {
+		return false
+	}
+	var se *statusError
+	if errors.As(err, &se) {
+		return isPeerFailure(se)
+	}
+	return errors.Is(err, ErrOverloaded) || errors.Is(err, ErrCircuitOpen) ||
+		errors.Is(err, ErrPeerUnreachable) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
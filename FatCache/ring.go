@@ -0,0 +1,118 @@
+package fatcache
+
+import (
+	"context"
+	"hash/fnv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// headerHop 标记请求已经由其他节点转发，接收方必须在本地处理，不能再次转发
+	headerHop = "X-Fatcache-Hop"
+	// headerRing 携带发送方的哈希环版本，用于发现节点列表不一致
+	headerRing = "X-Fatcache-Ring"
+	// headerTags 在响应中携带数据的标签，每个标签经过 URL 编码，以逗号分隔
+	headerTags = "X-Fatcache-Tags"
+)
+
+type forwardedKey struct{}
+
+// withForwarded 标记 ctx 对应的请求来自其他节点
+func withForwarded(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forwardedKey{}, true)
+}
+
+func isForwarded(ctx context.Context) bool {
+	v, _ := ctx.Value(forwardedKey{}).(bool)
+	return v
+}
+
+type peerHintKey struct{}
+
+// peerHint 随节点间请求传递发送方的代数，并带回远端节点的代数和数据的标签
+type peerHint struct {
+	sent uint64
+	seen atomic.Uint64
+
+	mu   sync.Mutex
+	tags []string
+}
+
+// observe 记录远端节点的代数，对冲请求可能并发调用
+func (h *peerHint) observe(gen uint64) {
+	for {
+		cur := h.seen.Load()
+		if gen <= cur || h.seen.CompareAndSwap(cur, gen) {
+			return
+		}
+	}
+}
+
+func (h *peerHint) setTags(tags []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tags = tags
+}
+
+func (h *peerHint) tagList() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.tags
+}
+
+func encodeTags(tags []string) string {
+	escaped := make([]string, len(tags))
+	for i, tag := range tags {
+		escaped[i] = url.QueryEscape(tag)
+	}
+	return strings.Join(escaped, ",")
+}
+
+func decodeTags(header string) []string {
+	if header == "" {
+		return nil
+	}
+	parts := strings.Split(header, ",")
+	tags := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if tag, err := url.QueryUnescape(p); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func withPeerHint(ctx context.Context, h *peerHint) context.Context {
+	return context.WithValue(ctx, peerHintKey{}, h)
+}
+
+func peerHintFrom(ctx context.Context) *peerHint {
+	h, _ := ctx.Value(peerHintKey{}).(*peerHint)
+	return h
+}
+
+// ringVersion 根据节点列表计算哈希环版本，节点列表相同的节点得到相同的版本
+func ringVersion(peers []string) string {
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	h := fnv.New64a()
+	for _, p := range sorted {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// RingStatus 描述本节点与其他节点的哈希环版本是否一致
+type RingStatus struct {
+	Version string
+	// Mismatched 为最近一次通信时版本与本节点不同的远端节点及其版本
+	Mismatched map[string]string
+	// MismatchedRequests 为收到的版本不一致的转发请求数
+	MismatchedRequests int64
+}
@@ -0,0 +1,86 @@
+package fatcache
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// SimNode 是模拟集群中的一个虚拟节点
+type SimNode struct {
+	Name  string
+	Node  *Node
+	Pool  *MemoryPool
+	Group *Group
+	loads atomic.Int64
+}
+
+// Loads 返回该节点调用 Getter 的次数
+func (n *SimNode) Loads() int64 {
+	return n.loads.Load()
+}
+
+// SimCluster 在 MemoryNetwork 上运行 N 个虚拟节点，每个节点有一个同名 Group，
+// 用于确定性地测试故障转移、失效等集群行为
+type SimCluster struct {
+	Network *MemoryNetwork
+	Nodes   []*SimNode
+}
+
+// NewSimCluster 创建 n 个节点的模拟集群，load 为每个节点的数据源，node 为加载数据的节点名
+func NewSimCluster(n int, seed int64, group string, cacheBytes int64,
+	load func(node, key string) ([]byte, error), opts ...GroupOption) *SimCluster {
+	c := &SimCluster{Network: NewMemoryNetwork(seed)}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("node%d", i)
+	}
+	for _, name := range names {
+		sn := &SimNode{Name: name, Node: NewNode()}
+		sn.Pool = c.Network.Join(name, sn.Node)
+		sn.Pool.Set(names...)
+		sn.Group = sn.Node.NewGroup(group, cacheBytes, GetterFunc(func(key string) ([]byte, error) {
+			sn.loads.Add(1)
+			return load(sn.Name, key)
+		}), opts...)
+		c.Nodes = append(c.Nodes, sn)
+	}
+	return c
+}
+
+// Get 从第 i 个节点读取 key
+func (c *SimCluster) Get(i int, key string) (ByteView, error) {
+	return c.Nodes[i].Group.Get(key)
+}
+
+// Node 按名称返回节点，不存在时返回 nil
+func (c *SimCluster) Node(name string) *SimNode {
+	for _, n := range c.Nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// Owner 返回负责 key 的节点
+func (c *SimCluster) Owner(key string) *SimNode {
+	return c.Node(c.Nodes[0].Pool.Owner(key))
+}
+
+// Loads 返回各节点调用 Getter 的次数
+func (c *SimCluster) Loads() map[string]int64 {
+	loads := make(map[string]int64, len(c.Nodes))
+	for _, n := range c.Nodes {
+		loads[n.Name] = n.Loads()
+	}
+	return loads
+}
+
+// TotalLoads 返回整个集群调用 Getter 的总次数
+func (c *SimCluster) TotalLoads() int64 {
+	var total int64
+	for _, n := range c.Nodes {
+		total += n.Loads()
+	}
+	return total
+}
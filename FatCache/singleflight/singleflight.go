@@ -29,6 +29,8 @@ func (g *Group) Do(key string, fn func() (value interface{}, err error)) (value
 	c := new(call)
 	c.wg.Add(1)
 	g.stash[key] = c
+	g.mu.Unlock()
+
 	c.val, c.err = fn()
 	c.wg.Done()
 
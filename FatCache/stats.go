@@ -0,0 +1,110 @@
+package fatcache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// groupStats 记录 Group 的运行计数，所有字段均可并发更新
+type groupStats struct {
+	gets          atomic.Int64
+	cacheHits     atomic.Int64
+	peerLoads     atomic.Int64
+	peerErrors    atomic.Int64
+	peerRetries   atomic.Int64
+	peerHedges    atomic.Int64
+	localLoads    atomic.Int64
+	localLoadErrs atomic.Int64
+	tierHits      atomic.Int64
+
+	writes             atomic.Int64
+	writeErrors        atomic.Int64
+	writesCoalesced    atomic.Int64
+	writeFlushes       atomic.Int64
+	writeRetries       atomic.Int64
+	writeFlushFailures atomic.Int64
+
+	batchLoads  atomic.Int64
+	batchedKeys atomic.Int64
+}
+
+// GroupStats 是 Group 运行计数的快照
+type GroupStats struct {
+	Gets          int64
+	CacheHits     int64
+	PeerLoads     int64
+	PeerErrors    int64
+	PeerRetries   int64
+	PeerHedges    int64
+	LocalLoads    int64
+	LocalLoadErrs int64
+	// SecondTierHits 为内存缓存未命中、从二级缓存读到的次数
+	SecondTierHits int64
+	// CacheBytes 与 CacheItems 为内存缓存已计入的字节数和缓存项数量
+	CacheBytes int64
+	CacheItems int
+
+	// Writes 为写入后端存储的 Set 次数，WriteErrors 为同步写入失败的次数
+	Writes      int64
+	WriteErrors int64
+	// 写回队列的长度、被合并的写入、写入批次、重试次数及重试后仍失败的批次
+	WriteQueueDepth    int
+	WritesCoalesced    int64
+	WriteFlushes       int64
+	WriteRetries       int64
+	WriteFlushFailures int64
+
+	// BatchLoads 为 GetBatch 的调用次数，BatchedKeys 为通过它加载的 key 总数
+	BatchLoads  int64
+	BatchedKeys int64
+
+	// 加载限制的状态：正在加载和排队等待的数量、被拒绝的次数及累计等待时间
+	LoadsInFlight int64
+	LoadsQueued   int64
+	LoadsRejected int64
+	LoadWait      time.Duration
+
+	// Peers 为各远端节点的状态，仅当 PeerPicker 提供节点统计时存在
+	Peers map[string]PeerStats
+}
+
+// Stats 返回 Group 当前的运行计数
+func (g *Group) Stats() GroupStats {
+	s := GroupStats{
+		Gets:          g.stats.gets.Load(),
+		CacheHits:     g.stats.cacheHits.Load(),
+		PeerLoads:     g.stats.peerLoads.Load(),
+		PeerErrors:    g.stats.peerErrors.Load(),
+		PeerRetries:   g.stats.peerRetries.Load(),
+		PeerHedges:    g.stats.peerHedges.Load(),
+		LocalLoads:    g.stats.localLoads.Load(),
+		LocalLoadErrs: g.stats.localLoadErrs.Load(),
+
+		SecondTierHits: g.stats.tierHits.Load(),
+		CacheBytes:     g.mainCache.used.Load(),
+		CacheItems:     g.mainCache.len(),
+
+		Writes:             g.stats.writes.Load(),
+		WriteErrors:        g.stats.writeErrors.Load(),
+		WritesCoalesced:    g.stats.writesCoalesced.Load(),
+		WriteFlushes:       g.stats.writeFlushes.Load(),
+		WriteRetries:       g.stats.writeRetries.Load(),
+		WriteFlushFailures: g.stats.writeFlushFailures.Load(),
+
+		BatchLoads:  g.stats.batchLoads.Load(),
+		BatchedKeys: g.stats.batchedKeys.Load(),
+	}
+	if g.writeBehind != nil {
+		s.WriteQueueDepth = g.writeBehind.depth()
+	}
+	if l := g.limiter; l != nil {
+		s.LoadsInFlight = l.inFlight.Load()
+		s.LoadsQueued = l.queued.Load()
+		s.LoadsRejected = l.rejected.Load()
+		s.LoadWait = time.Duration(l.waitNs.Load())
+	}
+	if p, ok := g.peerPicker().(peerStatser); ok {
+		s.Peers = p.PeerStats()
+	}
+	return s
+}
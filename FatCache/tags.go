@@ -0,0 +1,232 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// TaggedGetter 是可选接口，Getter 实现后可以为加载的数据附加标签，
+// 之后可以通过 Group.InvalidateTag 一次删除带有同一标签的所有数据
+type TaggedGetter interface {
+	GetTagged(key string) ([]byte, []string, error)
+}
+
+type TaggedGetterFunc func(key string) ([]byte, []string, error)
+
+// 实现 Getter 接口
+func (f TaggedGetterFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// 实现 TaggedGetter 接口
+func (f TaggedGetterFunc) GetTagged(key string) ([]byte, []string, error) {
+	return f(key)
+}
+
+// TagInvalidator 是可选接口，实现后 Group.InvalidateTag 会通知远端节点删除带有标签的数据
+type TagInvalidator interface {
+	InvalidateTag(ctx context.Context, group string, tag string) error
+}
+
+// tagIndex 记录标签与缓存 key 的对应关系。
+// 缓存项被淘汰且没有二级缓存时从索引中删除；写入二级缓存的数据保留在索引中，
+// 使 InvalidateTag 也能删除二级缓存中的数据，二级缓存自行丢弃数据时通过 DropNotifier 删除。
+//
+// 每次失效使 epoch 加一并记录到 invalidated，加载开始时取得当时的 epoch，
+// 结束后若数据的标签在此之后被失效则不写入缓存。没有进行中的加载时清空 invalidated
+type tagIndex struct {
+	mu    sync.Mutex
+	byTag map[string]map[string]struct{}
+	byKey map[string][]string
+
+	epoch       uint64
+	invalidated map[string]uint64
+	active      int
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{
+		byTag: make(map[string]map[string]struct{}),
+		byKey: make(map[string][]string),
+
+		invalidated: make(map[string]uint64),
+	}
+}
+
+// begin 在加载开始前调用，返回当前的 epoch，结束后须调用 end
+func (t *tagIndex) begin() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active++
+	return t.epoch
+}
+
+// current 返回当前的 epoch，调用方须在 begin 与 end 之间调用
+func (t *tagIndex) current() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.epoch
+}
+
+func (t *tagIndex) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.active--; t.active == 0 {
+		clear(t.invalidated)
+	}
+}
+
+// stale 返回 tags 中是否有标签在 since 之后被失效
+func (t *tagIndex) stale(tags []string, since uint64) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tag := range tags {
+		if t.invalidated[tag] > since {
+			return true
+		}
+	}
+	return false
+}
+
+// set 替换 key 的标签，tags 为空时删除 key
+func (t *tagIndex) set(key string, tags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.byKey[key]; !ok && len(tags) == 0 {
+		return
+	}
+	t.removeLocked(key)
+	if len(tags) == 0 {
+		return
+	}
+	t.byKey[key] = tags
+	for _, tag := range tags {
+		keys, ok := t.byTag[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			t.byTag[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (t *tagIndex) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.byTag = make(map[string]map[string]struct{})
+	t.byKey = make(map[string][]string)
+}
+
+func (t *tagIndex) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeLocked(key)
+}
+
+func (t *tagIndex) removeLocked(key string) {
+	for _, tag := range t.byKey[key] {
+		if keys := t.byTag[tag]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(t.byTag, tag)
+			}
+		}
+	}
+	delete(t.byKey, key)
+}
+
+func (t *tagIndex) tags(key string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.byKey[key]
+}
+
+// take 返回带有 tag 的所有 key，并把它们从索引中删除
+func (t *tagIndex) take(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.epoch++
+	if t.active > 0 {
+		t.invalidated[tag] = t.epoch
+	}
+	keys := make([]string, 0, len(t.byTag[tag]))
+	for key := range t.byTag[tag] {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		t.removeLocked(key)
+	}
+	return keys
+}
+
+// SetTagged 与 Set 相同，同时为数据附加标签
+func (g *Group) SetTagged(key string, value []byte, tags ...string) error {
+	value = cloneBytes(value)
+	if g.setter != nil {
+		g.stats.writes.Add(1)
+		if err := g.setter.Set(key, value); err != nil {
+			g.stats.writeErrors.Add(1)
+			return fmt.Errorf("failed to write key %s: %w", key, err)
+		}
+	}
+	ck := g.cacheKey(key)
+	err := g.populateCache(ck, value, tags)
+	g.removeFromSecondTier(ck)
+	if err != nil {
+		if g.setter == nil {
+			return err
+		}
+		// 后端存储已经写入，无法缓存时删除旧值并返回成功，之后的读取从后端重新加载
+		g.log(LevelWarn, "written value not cached", F("key", key), F("err", err))
+		g.tags.remove(ck)
+		g.mainCache.remove(ck)
+	}
+	if g.writeBehind != nil {
+		g.stats.writes.Add(1)
+		g.writeBehind.enqueue(key, value)
+	}
+	g.publish(Event{Type: EventSet, Key: key, Value: value, Tags: tags})
+	return nil
+}
+
+// Tags 返回本节点缓存中 key 的标签
+func (g *Group) Tags(key string) []string {
+	return g.tags.tags(g.cacheKey(key))
+}
+
+// InvalidateTag 删除本节点上带有 tag 的所有数据，并通知实现了 TagInvalidator 的远端节点，
+// 返回本节点删除的数量
+func (g *Group) InvalidateTag(ctx context.Context, tag string) (int, error) {
+	n := g.invalidateTagLocally(tag)
+	g.publish(Event{Type: EventInvalidateTag, Tags: []string{tag}})
+	lister, ok := g.peerPicker().(PeerLister)
+	if !ok {
+		return n, nil
+	}
+	var errs []error
+	for _, peer := range lister.Peers() {
+		if p, ok := peer.(TagInvalidator); ok {
+			if err := p.InvalidateTag(ctx, g.name, tag); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return n, fmt.Errorf("failed to invalidate tag %s on peers: %w", tag, errors.Join(errs...))
+	}
+	return n, nil
+}
+
+func (g *Group) invalidateTagLocally(tag string) int {
+	n := 0
+	for _, ck := range g.tags.take(tag) {
+		if g.mainCache.remove(ck) {
+			n++
+		}
+		g.removeFromSecondTier(ck)
+	}
+	return n
+}
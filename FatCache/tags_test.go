@@ -0,0 +1,226 @@
+package fatcache
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// userViews 为每个 key 附加其所属用户的标签，key 形如 user1:profile
+var userViews = TaggedGetterFunc(func(key string) ([]byte, []string, error) {
+	user, _, _ := strings.Cut(key, ":")
+	return []byte("view of " + key), []string{user}, nil
+})
+
+func TestInvalidateTag(t *testing.T) {
+	group := NewGroup("tagGroup", 1<<20, userViews)
+	for _, key := range []string{"user1:profile", "user1:feed", "user2:profile"} {
+		group.Get(key)
+	}
+	group.SetTagged("user1:avatar", []byte("png"), "user1", "images")
+
+	n, err := group.InvalidateTag(context.Background(), "user1")
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 entries invalidated, got %d err %v", n, err)
+	}
+	for _, key := range []string{"user1:profile", "user1:feed", "user1:avatar"} {
+		if _, ok := group.Peek(key); ok {
+			t.Fatalf("expected %s to be invalidated", key)
+		}
+	}
+	if _, ok := group.Peek("user2:profile"); !ok {
+		t.Fatalf("expected untagged user to stay cached")
+	}
+	if len(group.tags.byTag["images"]) != 0 {
+		t.Fatalf("expected other tags of invalidated keys to be cleaned up")
+	}
+
+	// Set 不带标签时清除原有标签
+	group.Set("user2:profile", []byte("fresh"))
+	if tags := group.Tags("user2:profile"); len(tags) != 0 {
+		t.Fatalf("expected Set to clear tags, got %v", tags)
+	}
+}
+
+func TestTagIndexFollowsEviction(t *testing.T) {
+	group := NewGroup("tagEvictGroup", 60, userViews)
+	for i := 0; i < 10; i++ {
+		group.Get(fmt.Sprintf("user%d:profile", i))
+	}
+	if keys, items := len(group.tags.byKey), group.Stats().CacheItems; keys != items {
+		t.Fatalf("expected tag index to track %d cached keys, got %d", items, keys)
+	}
+
+	tier := mapTier{}
+	tiered := NewGroup("tagTierGroup", 60, userViews, WithSecondTier(tier))
+	tiered.Get("user1:profile")
+	tiered.Get("user2:profile")
+	tiered.Get("user3:profile")
+	if _, ok := tier[tiered.cacheKey("user1:profile")]; !ok {
+		t.Fatalf("expected user1:profile in second tier")
+	}
+	tiered.InvalidateTag(context.Background(), "user1")
+	if _, ok := tier[tiered.cacheKey("user1:profile")]; ok {
+		t.Fatalf("expected tagged entry to be removed from the second tier")
+	}
+	if _, ok := tier[tiered.cacheKey("user2:profile")]; !ok {
+		t.Fatalf("expected entries with other tags to stay in the second tier")
+	}
+}
+
+// dropTier 是可以模拟自行丢弃数据的二级缓存
+type dropTier struct {
+	mapTier
+	onDrop func(key string)
+}
+
+func (d *dropTier) OnDrop(fn func(key string)) { d.onDrop = fn }
+
+func (d *dropTier) drop(key string) {
+	delete(d.mapTier, key)
+	d.onDrop(key)
+}
+
+func TestTagIndexFollowsTierDrops(t *testing.T) {
+	tier := &dropTier{mapTier: mapTier{}}
+	group := NewGroup("tagDropGroup", 60, userViews, WithSecondTier(tier))
+	group.Get("user1:profile")
+	group.Get("user2:profile")
+	group.Get("user3:profile")
+	ck := group.cacheKey("user1:profile")
+	if _, ok := tier.mapTier[ck]; !ok {
+		t.Fatalf("expected user1:profile in second tier")
+	}
+	tier.drop(ck)
+	if tags := group.Tags("user1:profile"); len(tags) != 0 {
+		t.Fatalf("expected tags of dropped entry to be removed, got %v", tags)
+	}
+	if _, ok := group.tags.byTag["user1"]; ok {
+		t.Fatalf("expected tag index to forget user1")
+	}
+}
+
+func TestInvalidateTagDuringLoad(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	group := NewGroup("tagRaceGroup", 1<<20, TaggedGetterFunc(func(key string) ([]byte, []string, error) {
+		close(loading)
+		<-release
+		return []byte("stale"), []string{"user1"}, nil
+	}))
+	done := make(chan error)
+	go func() {
+		_, err := group.Get("user1:profile")
+		done <- err
+	}()
+	<-loading
+	group.InvalidateTag(context.Background(), "user1")
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := group.Peek("user1:profile"); ok {
+		t.Fatalf("expected value loaded before invalidation not to be cached")
+	}
+	if len(group.tags.invalidated) != 0 {
+		t.Fatalf("expected invalidation records to be cleared after loads finish")
+	}
+}
+
+func TestInvalidateTagBeforeJoiningLoad(t *testing.T) {
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	missed := make(chan struct{}, 2)
+	group := NewGroup("tagJoinGroup", 1<<20, TaggedGetterFunc(func(key string) ([]byte, []string, error) {
+		close(loading)
+		<-release
+		return []byte("stale"), []string{"user1"}, nil
+	}), WithHooks(Hooks{OnMiss: func(group, key string) { missed <- struct{}{} }}))
+	done := make(chan error, 2)
+	get := func() {
+		_, err := group.Get("user1:profile")
+		done <- err
+	}
+	go get()
+	<-loading
+	<-missed
+	group.InvalidateTag(context.Background(), "user1")
+
+	// 失效之后才加入的请求共享的仍是失效前开始的加载
+	go get()
+	<-missed
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, ok := group.Peek("user1:profile"); ok {
+		t.Fatalf("expected value loaded before invalidation not to be cached by a later waiter")
+	}
+}
+
+func TestInvalidateTagCluster(t *testing.T) {
+	net := NewMemoryNetwork(1)
+	names := []string{"a", "b", "c"}
+	var groups []*Group
+	for _, name := range names {
+		node := NewNode()
+		net.Join(name, node).Set(names...)
+		groups = append(groups, node.NewGroup("views", 1<<20, userViews))
+	}
+
+	// 每个节点都缓存一份，包括从远端节点取回的数据
+	for _, g := range groups {
+		g.Get("user1:profile")
+		if tags := g.Tags("user1:profile"); len(tags) != 1 || tags[0] != "user1" {
+			t.Fatalf("expected tags to follow the value across peers, got %v", tags)
+		}
+	}
+	if _, err := groups[0].InvalidateTag(context.Background(), "user1"); err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range groups {
+		if _, ok := g.Peek("user1:profile"); ok {
+			t.Fatalf("expected node %s to drop tagged entry", names[i])
+		}
+	}
+}
+
+func TestInvalidateTagHTTP(t *testing.T) {
+	servers := make([]*httptest.Server, 2)
+	addrs := make([]string, 2)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		addrs[i] = servers[i].Listener.Addr().String()
+	}
+	var groups []*Group
+	for i, server := range servers {
+		node := NewNode()
+		pool := node.NewHTTPPool(addrs[i], nil)
+		pool.Set(addrs...)
+		groups = append(groups, node.NewGroup("views", 1<<20, userViews))
+		server.Config.Handler = pool
+		server.Start()
+		t.Cleanup(server.Close)
+	}
+
+	for _, g := range groups {
+		g.Get("user/1:profile")
+		if tags := g.Tags("user/1:profile"); len(tags) != 1 || tags[0] != "user/1" {
+			t.Fatalf("expected tags in peer response, got %v", tags)
+		}
+	}
+	if _, err := groups[1].InvalidateTag(context.Background(), "user/1"); err != nil {
+		t.Fatalf("Error invalidating tag: %v", err)
+	}
+	for _, g := range groups {
+		if _, ok := g.Peek("user/1:profile"); ok {
+			t.Fatalf("expected tagged entry to be invalidated on every node")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package fatcache
+
+// SecondTier 是内存缓存之后的二级缓存，例如 disk.Store。
+// 内存缓存淘汰的数据写入二级缓存，内存未命中时先查二级缓存，再访问远端节点或 Getter
+type SecondTier interface {
+	Put(key string, value []byte) error
+	Get(key string) ([]byte, bool, error)
+	Delete(key string) error
+}
+
+// DropNotifier 是可选接口，二级缓存实现后会在自行丢弃数据（超出容量、压缩时发现损坏等）时
+// 调用 fn，Group 借此从标签索引中删除对应的 key。fn 可能在二级缓存持有锁时调用，不能再访问二级缓存
+type DropNotifier interface {
+	OnDrop(fn func(key string))
+}
+
+// WithSecondTier 为 Group 设置二级缓存
+func WithSecondTier(t SecondTier) GroupOption {
+	return func(g *Group) {
+		g.secondTier = t
+		if d, ok := t.(DropNotifier); ok {
+			d.OnDrop(g.onTierDrop)
+		}
+	}
+}
+
+// onEvicted 在数据被内存缓存淘汰后调用：有二级缓存时写入二级缓存，否则从标签索引中删除
+func (g *Group) onEvicted(key string, value ByteView) {
+	g.log(LevelDebug, "evicted", F("key", key))
+	if g.hooks.OnEvict != nil {
+		g.hooks.OnEvict(g.name, userKey(key), value.Len())
+	}
+	if g.secondTier == nil {
+		g.tags.remove(key)
+		return
+	}
+	if err := g.secondTier.Put(key, value.b); err != nil {
+		g.log(LevelWarn, "second tier put failed", F("key", key), F("err", err))
+		g.tags.remove(key)
+	}
+}
+
+// onTierDrop 在二级缓存丢弃 key 时调用，已重新读入内存缓存的 key 保留标签
+func (g *Group) onTierDrop(key string) {
+	if _, ok := g.mainCache.get(key); !ok {
+		g.tags.remove(key)
+	}
+}
+
+func (g *Group) getFromSecondTier(key string) (ByteView, bool) {
+	if g.secondTier == nil {
+		return ByteView{}, false
+	}
+	b, ok, err := g.secondTier.Get(key)
+	if err != nil || !ok {
+		return ByteView{}, false
+	}
+	if b, err = g.decodeValue(key, b); err != nil {
+		return ByteView{}, false
+	}
+	g.stats.tierHits.Add(1)
+	return ByteView{b: b}, true
+}
+
+// removeFromSecondTier 删除二级缓存中的 key，并取消尚未写入二级缓存的淘汰数据。
+// 删除数据时须先从内存缓存中删除再调用它，否则之间被淘汰的旧值会在删除后写入二级缓存
+func (g *Group) removeFromSecondTier(key string) {
+	if g.secondTier != nil {
+		g.mainCache.forget(key, func() { g.secondTier.Delete(key) })
+	}
+}
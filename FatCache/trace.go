@@ -0,0 +1,210 @@
+package fatcache
+
+import (
+	"context"
+	"encoding/hex"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+)
+
+// headerTraceparent 为 W3C Trace Context 的请求头
+const headerTraceparent = "traceparent"
+
+// SpanContext 标识一个 span，按 W3C traceparent 在节点间传递
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// IsValid 报告 TraceID 和 SpanID 是否均非零
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent 返回 sc 的 traceparent 请求头取值
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent 解析 traceparent 请求头，格式不正确时返回 false
+func ParseTraceparent(s string) (SpanContext, bool) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' || s[:2] == "ff" {
+		return sc, false
+	}
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], []byte(s[:2])); err != nil {
+		return sc, false
+	}
+	// 版本 00 的长度固定，未来的版本可能在后面追加字段
+	if version[0] == 0 && len(s) != 55 || len(s) > 55 && s[55] != '-' {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(s[53:55])); err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext 返回携带 sc 的 ctx，之后的 span 以 sc 为父 span，远端请求也会携带 sc
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext 返回 ctx 中当前的 span，没有时返回零值
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Span 是一个计时的阶段，End 之后不应再使用
+type Span interface {
+	Context() SpanContext
+	SetAttribute(key, value string)
+	End(err error)
+}
+
+// Tracer 创建 span，parent 无效时应开始新的 trace
+type Tracer interface {
+	Start(name string, parent SpanContext) Span
+}
+
+// WithTracer 为 Group 的读取过程记录 span：fatcache.get 之下依次为
+// fatcache.lookup（加锁查找缓存）、fatcache.load（包括 singleflight 等待）、
+// fatcache.peer 或 fatcache.getter，以及 fatcache.populate
+func WithTracer(t Tracer) GroupOption {
+	return func(g *Group) {
+		g.tracer = t
+	}
+}
+
+// startSpan 在 ctx 当前的 span 之下开始一个 span，未设置 Tracer 时返回空操作的 span
+func startSpan(ctx context.Context, t Tracer, name string) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	span := t.Start(name, SpanContextFromContext(ctx))
+	return ContextWithSpanContext(ctx, span.Context()), span
+}
+
+func (g *Group) startSpan(ctx context.Context, name, key string) (context.Context, Span) {
+	ctx, span := startSpan(ctx, g.tracer, name)
+	span.SetAttribute("group", g.name)
+	span.SetAttribute("key", key)
+	return ctx, span
+}
+
+type noopSpan struct{}
+
+func (noopSpan) Context() SpanContext         { return SpanContext{} }
+func (noopSpan) SetAttribute(key, val string) {}
+func (noopSpan) End(err error)                {}
+
+// SpanRecord 是 InMemoryTracer 记录的已结束 span
+type SpanRecord struct {
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Start      time.Time
+	Duration   time.Duration
+	Attributes map[string]string
+	Err        error
+}
+
+// InMemoryTracer 在内存中保存所有已结束的 span，用于测试和调试
+type InMemoryTracer struct {
+	mu    sync.Mutex
+	spans []SpanRecord
+}
+
+func NewInMemoryTracer() *InMemoryTracer {
+	return &InMemoryTracer{}
+}
+
+// Start 实现 Tracer 接口
+func (t *InMemoryTracer) Start(name string, parent SpanContext) Span {
+	sc := SpanContext{TraceID: parent.TraceID, Sampled: true}
+	if !parent.IsValid() {
+		putRandom(sc.TraceID[:])
+	}
+	putRandom(sc.SpanID[:])
+	return &memorySpan{tracer: t, rec: SpanRecord{
+		Name:       name,
+		Context:    sc,
+		Parent:     parent,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+	}}
+}
+
+// Spans 返回已结束的 span，按开始时间排序
+func (t *InMemoryTracer) Spans() []SpanRecord {
+	t.mu.Lock()
+	spans := append([]SpanRecord(nil), t.spans...)
+	t.mu.Unlock()
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	return spans
+}
+
+// Reset 清空已记录的 span
+func (t *InMemoryTracer) Reset() {
+	t.mu.Lock()
+	t.spans = nil
+	t.mu.Unlock()
+}
+
+type memorySpan struct {
+	tracer *InMemoryTracer
+	mu     sync.Mutex
+	rec    SpanRecord
+	ended  bool
+}
+
+func (s *memorySpan) Context() SpanContext {
+	return s.rec.Context
+}
+
+func (s *memorySpan) SetAttribute(key, value string) {
+	s.mu.Lock()
+	s.rec.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+func (s *memorySpan) End(err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.rec.Duration = time.Since(s.rec.Start)
+	s.rec.Err = err
+	rec := s.rec
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, rec)
+	s.tracer.mu.Unlock()
+}
+
+func putRandom(b []byte) {
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+}
@@ -0,0 +1,167 @@
+package fatcache
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTraceparent(t *testing.T) {
+	const s = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(s)
+	if !ok || !sc.Sampled || sc.Traceparent() != s {
+		t.Fatalf("unexpected span context %+v for %s", sc, s)
+	}
+	for _, bad := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(bad); ok {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+	// 未来的版本可以在后面追加字段
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); !ok {
+		t.Fatalf("expected future version to be accepted")
+	}
+}
+
+func TestTracingSpans(t *testing.T) {
+	tracer := NewInMemoryTracer()
+	group := NewGroup("traceSpanGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		return []byte("v"), nil
+	}), WithTracer(tracer))
+
+	group.Get("key")
+	group.Get("key")
+
+	spans := tracer.Spans()
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name
+	}
+	want := "[fatcache.get fatcache.lookup fatcache.load fatcache.getter fatcache.populate fatcache.get fatcache.lookup]"
+	if fmt.Sprint(names) != want {
+		t.Fatalf("unexpected spans %v", names)
+	}
+	byName := map[string]SpanRecord{}
+	for _, s := range spans[:5] {
+		byName[s.Name] = s
+	}
+	root := byName["fatcache.get"]
+	if root.Parent.IsValid() || root.Attributes["cache"] != "miss" || root.Attributes["key"] != "key" {
+		t.Fatalf("unexpected root span %+v", root)
+	}
+	if byName["fatcache.load"].Parent != root.Context || byName["fatcache.getter"].Parent != byName["fatcache.load"].Context {
+		t.Fatalf("unexpected span tree %+v", byName)
+	}
+	if spans[5].Attributes["cache"] != "hit" || spans[5].Context.TraceID == root.Context.TraceID {
+		t.Fatalf("expected second Get to start a new trace with a cache hit")
+	}
+}
+
+func TestTracingSingleflightWait(t *testing.T) {
+	tracer := NewInMemoryTracer()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	group := NewGroup("traceWaitGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte("v"), nil
+	}), WithTracer(tracer))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { defer wg.Done(); group.Get("key") }()
+	<-started
+	wg.Add(1)
+	go func() { defer wg.Done(); group.Get("key") }()
+	waitFor(t, "second load to wait", func() bool { return group.Stats().Gets == 2 })
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	var shared int
+	for _, s := range tracer.Spans() {
+		if s.Name == "fatcache.load" && s.Attributes["singleflight"] == "shared" {
+			shared++
+		}
+	}
+	if shared != 1 {
+		t.Fatalf("expected one shared load span, got %d", shared)
+	}
+}
+
+func TestTracingAcrossPeers(t *testing.T) {
+	tracer := NewInMemoryTracer()
+	type peerNode struct {
+		node   *Node
+		pool   *HTTPPool
+		group  *Group
+		server *httptest.Server
+		addr   string
+	}
+	nodes := make([]*peerNode, 2)
+	addrs := make([]string, 2)
+	for i := range nodes {
+		pn := &peerNode{node: NewNode()}
+		pn.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pn.pool.ServeHTTP(w, r)
+		}))
+		pn.addr = pn.server.Listener.Addr().String()
+		nodes[i], addrs[i] = pn, pn.addr
+	}
+	for _, pn := range nodes {
+		pn.pool = pn.node.NewHTTPPool(pn.addr, &HTTPPoolOptions{Tracer: tracer})
+		pn.pool.Set(addrs...)
+		addr := pn.addr
+		pn.group = pn.node.NewGroup("traced", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+			return []byte(addr), nil
+		}), WithTracer(tracer))
+		pn.server.Start()
+		t.Cleanup(pn.server.Close)
+	}
+
+	// 找到由另一个节点负责的 key
+	a := nodes[0]
+	var key string
+	for i := 0; ; i++ {
+		key = fmt.Sprintf("key%d", i)
+		if _, ok := a.pool.PickPeer(key); ok {
+			break
+		}
+	}
+	if _, err := a.group.Get(key); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := map[string][]SpanRecord{}
+	for _, s := range tracer.Spans() {
+		spans[s.Name] = append(spans[s.Name], s)
+	}
+	root := spans["fatcache.get"][0]
+	peer := spans["fatcache.peer"]
+	serve := spans["fatcache.serve"]
+	if len(peer) != 1 || len(serve) != 1 || len(spans["fatcache.getter"]) != 1 {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	if serve[0].Parent != peer[0].Context {
+		t.Fatalf("expected remote serve span to be a child of the peer span")
+	}
+	for name, list := range spans {
+		for _, s := range list {
+			if s.Context.TraceID != root.Context.TraceID {
+				t.Fatalf("span %s is not part of the trace", name)
+			}
+		}
+	}
+	if g := spans["fatcache.get"]; len(g) != 2 || g[1].Parent != serve[0].Context {
+		t.Fatalf("expected remote get span under the serve span, got %v", g)
+	}
+}
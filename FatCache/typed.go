@@ -0,0 +1,173 @@
+package fatcache
+
+import (
+	"bytes"
+	"context"
+	"fatcache/lru"
+	"sync"
+)
+
+// TypedGroup 在 Group 之上提供类型安全的 Get/Set，值通过 Codec 与 []byte 相互转换。
+// 本地命中时直接返回已解码的值，多个调用方可能拿到同一个值，调用方不应修改它
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+
+	mu      sync.Mutex
+	decoded *lru.TypedCache[string, decodedValue[T]]
+}
+
+// decodedValue 记录解码结果及其对应的缓存数据的版本号，
+// 缓存中的数据被替换或淘汰后版本号改变，解码结果随之失效
+type decodedValue[T any] struct {
+	version uint64
+	size    int
+	value   T
+}
+
+// NewTypedGroup 在默认 Node 上创建 Group，getter 返回的值经 codec 编码后缓存。
+// decodedBytes 为解码结果缓存的容量，按编码后的大小计算，<= 0 时不缓存解码结果
+func NewTypedGroup[T any](name string, cacheBytes int64, codec Codec[T], getter func(ctx context.Context, key string) (T, error), decodedBytes int64, opts ...GroupOption) *TypedGroup[T] {
+	g := NewGroup(name, cacheBytes, TypedGetter(codec, getter), opts...)
+	return Typed(g, codec, decodedBytes)
+}
+
+// Typed 为已有的 Group 创建 TypedGroup。
+// 使用 WithEncryption 的 Group 不缓存解码结果，避免明文常驻内存
+func Typed[T any](g *Group, codec Codec[T], decodedBytes int64) *TypedGroup[T] {
+	for _, c := range g.codecs {
+		if _, ok := c.(encryptCodec); ok {
+			decodedBytes = 0
+		}
+	}
+	t := &TypedGroup[T]{group: g, codec: codec}
+	if decodedBytes > 0 {
+		g.mainCache.trackVersions()
+		t.decoded = lru.NewTyped(lru.Options[string, decodedValue[T]]{
+			MaxBytes: decodedBytes,
+			Size: func(key string, d decodedValue[T]) int64 {
+				return int64(len(key) + d.size)
+			},
+		})
+	}
+	return t
+}
+
+// TypedGetter 把返回 T 的加载函数转换为 ContextGetter，加载时收到调用方的 ctx
+func TypedGetter[T any](codec Codec[T], getter func(ctx context.Context, key string) (T, error)) Getter {
+	return typedGetter[T]{codec, getter}
+}
+
+type typedGetter[T any] struct {
+	codec  Codec[T]
+	getter func(ctx context.Context, key string) (T, error)
+}
+
+func (t typedGetter[T]) Get(key string) ([]byte, error) {
+	return t.GetContext(context.Background(), key)
+}
+
+func (t typedGetter[T]) GetContext(ctx context.Context, key string) ([]byte, error) {
+	v, err := t.getter(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return t.codec.Marshal(v)
+}
+
+// Group 返回底层的 Group
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+func (t *TypedGroup[T]) Get(key string) (T, error) {
+	return t.GetContext(context.Background(), key)
+}
+
+// GetContext 与 Group.GetContext 相同，返回解码后的值
+func (t *TypedGroup[T]) GetContext(ctx context.Context, key string) (T, error) {
+	if v, ok := t.lookupDecoded(key); ok {
+		// 与 Group.GetContext 的命中一样计数、记录 span 并调用 OnHit
+		g := t.group
+		g.stats.gets.Add(1)
+		_, span := g.startSpan(ctx, "fatcache.get", key)
+		g.recordHit(span, key)
+		span.End(nil)
+		return v, nil
+	}
+
+	value, err := t.group.GetContext(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v, err := t.codec.Unmarshal(value.b)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	t.storeDecoded(key, value.b, v)
+	return v, nil
+}
+
+// Set 编码 v 并写入本节点的缓存
+func (t *TypedGroup[T]) Set(key string, v T) error {
+	b, err := t.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.group.Set(key, b)
+}
+
+// Remove 从本节点的缓存中删除 key
+func (t *TypedGroup[T]) Remove(key string) bool {
+	t.mu.Lock()
+	if t.decoded != nil {
+		t.decoded.Remove(key)
+	}
+	t.mu.Unlock()
+	return t.group.Remove(key)
+}
+
+func (t *TypedGroup[T]) lookupDecoded(key string) (T, bool) {
+	var zero T
+	if t.decoded == nil {
+		return zero, false
+	}
+	_, version, ok := t.group.mainCache.getVersion(t.group.cacheKey(key))
+	if !ok {
+		return zero, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.decoded.Get(key)
+	if !ok {
+		return zero, false
+	}
+	if d.version != version {
+		t.decoded.Remove(key)
+		return zero, false
+	}
+	return d.value, true
+}
+
+// storeDecoded 记录 v 与当前缓存数据的对应关系。
+// 缓存可能在 v 解码后被并发替换，数据不一致时不记录
+func (t *TypedGroup[T]) storeDecoded(key string, plain []byte, v T) {
+	if t.decoded == nil {
+		return
+	}
+	ck := t.group.cacheKey(key)
+	stored, version, ok := t.group.mainCache.getVersion(ck)
+	if !ok || len(stored.b) == 0 {
+		return
+	}
+	current, err := t.group.decodeValue(ck, stored.b)
+	if err != nil || !bytes.Equal(current, plain) {
+		return
+	}
+	t.mu.Lock()
+	t.decoded.Add(key, decodedValue[T]{version: version, size: len(stored.b), value: v})
+	t.mu.Unlock()
+}
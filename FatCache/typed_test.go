@@ -0,0 +1,143 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fatcache/arena"
+	"sync/atomic"
+	"testing"
+)
+
+type user struct {
+	Name string
+	Age  int
+}
+
+// countingCodec 统计 Unmarshal 次数，用于确认本地命中不再解码
+type countingCodec[T any] struct {
+	Codec[T]
+	unmarshals int32
+}
+
+func (c *countingCodec[T]) Unmarshal(b []byte) (T, error) {
+	atomic.AddInt32(&c.unmarshals, 1)
+	return c.Codec.Unmarshal(b)
+}
+
+func TestTypedGroup(t *testing.T) {
+	var loads int32
+	codec := &countingCodec[user]{Codec: JSONCodec[user]{}}
+	users := NewTypedGroup("typedGroup", 1<<20, codec, func(ctx context.Context, key string) (user, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "missing" {
+			return user{}, errors.New("not found")
+		}
+		return user{Name: key, Age: 30}, nil
+	}, 1<<10)
+
+	for i := 0; i < 3; i++ {
+		u, err := users.Get("tom")
+		if err != nil || u != (user{Name: "tom", Age: 30}) {
+			t.Fatalf("unexpected user %+v, err %v", u, err)
+		}
+	}
+	if loads != 1 || codec.unmarshals != 1 {
+		t.Fatalf("expected one load and one decode, got loads=%d unmarshals=%d", loads, codec.unmarshals)
+	}
+
+	// Set 替换缓存数据后，旧的解码结果失效
+	if err := users.Set("tom", user{Name: "tom", Age: 31}); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := users.Get("tom"); u.Age != 31 {
+		t.Fatalf("expected updated user, got %+v", u)
+	}
+	if _, err := users.Get("missing"); err == nil {
+		t.Fatalf("expected getter error")
+	}
+}
+
+func TestTypedGroupDecodedHit(t *testing.T) {
+	var hits int32
+	tracer := NewInMemoryTracer()
+	codec := &countingCodec[user]{Codec: JSONCodec[user]{}}
+	users := NewTypedGroup("typedHitGroup", 1<<20, codec, func(ctx context.Context, key string) (user, error) {
+		return user{Name: key}, nil
+	}, 1<<10, WithTracer(tracer), WithHooks(Hooks{OnHit: func(group, key string) { atomic.AddInt32(&hits, 1) }}))
+
+	users.Get("tom")
+	tracer.Reset()
+	users.Get("tom")
+	if codec.unmarshals != 1 {
+		t.Fatalf("expected second Get to use the decoded value, got %d decodes", codec.unmarshals)
+	}
+	// 使用解码结果的命中与 Group 的命中一样计数、记录 span 并调用 OnHit
+	spans := tracer.Spans()
+	if hits != 1 || len(spans) != 1 || spans[0].Name != "fatcache.get" || spans[0].Attributes["cache"] != "hit" {
+		t.Fatalf("expected hit bookkeeping, got hits=%d spans=%+v", hits, spans)
+	}
+	if stats := users.Group().Stats(); stats.Gets != 2 || stats.CacheHits != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTypedGroupCodecs(t *testing.T) {
+	gob := Typed(NewGroup("gobGroup", 1<<20, nil), GobCodec[map[string]int]{}, 0)
+	if err := gob.Set("m", map[string]int{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := gob.Get("m"); err != nil || m["a"] != 1 {
+		t.Fatalf("unexpected gob value %v, err %v", m, err)
+	}
+
+	raw := Typed(NewGroup("rawGroup", 1<<20, nil), BytesCodec{}, 1<<10)
+	raw.Set("b", []byte("bytes"))
+	if b, err := raw.Get("b"); err != nil || string(b) != "bytes" {
+		t.Fatalf("unexpected raw value %q, err %v", b, err)
+	}
+}
+
+func TestTypedGroupContext(t *testing.T) {
+	type ctxKey struct{}
+	var seen interface{}
+	users := NewTypedGroup("typedCtxGroup", 1<<20, JSONCodec[user]{}, func(ctx context.Context, key string) (user, error) {
+		seen = ctx.Value(ctxKey{})
+		if err := ctx.Err(); err != nil {
+			return user{}, err
+		}
+		return user{Name: key}, nil
+	}, 0)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	if _, err := users.GetContext(ctx, "tom"); err != nil || seen != "request" {
+		t.Fatalf("expected caller ctx to reach the getter, got %v, err %v", seen, err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := users.GetContext(canceled, "jerry"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected cancellation to reach the getter, got %v", err)
+	}
+}
+
+func TestTypedGroupArenaStore(t *testing.T) {
+	codec := &countingCodec[user]{Codec: JSONCodec[user]{}}
+	users := NewTypedGroup("typedArenaGroup", 1<<20, codec, func(ctx context.Context, key string) (user, error) {
+		return user{Name: key}, nil
+	}, 1<<10, WithStore(func(maxBytes int64, onEvict func(string, []byte)) Store {
+		return arena.New(maxBytes, onEvict)
+	}))
+
+	// arena 返回数据的副本，按版本号判断解码结果是否仍然有效
+	for i := 0; i < 3; i++ {
+		if u, err := users.Get("tom"); err != nil || u.Name != "tom" {
+			t.Fatalf("unexpected user %+v, err %v", u, err)
+		}
+	}
+	if codec.unmarshals != 1 {
+		t.Fatalf("expected decoded value to be reused with the arena store, got %d decodes", codec.unmarshals)
+	}
+	users.Set("tom", user{Name: "tom", Age: 1})
+	if u, _ := users.Get("tom"); u.Age != 1 {
+		t.Fatalf("expected updated user, got %+v", u)
+	}
+}
@@ -0,0 +1,237 @@
+package fatcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fatcache/consisitenthash"
+	"fatcache/lru"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// defaultWarmConcurrency 为预热时默认的并发加载数
+const defaultWarmConcurrency = 8
+
+// WarmResult 是一次预热的结果
+type WarmResult struct {
+	// Loaded 为新加载到缓存中的 key 数量，Cached 为预热前已在缓存中的数量
+	Loaded int
+	Cached int
+	// Failed 为加载失败的 key 数量，Err 为遇到的第一个错误
+	Failed int
+	Err    error
+}
+
+func (r *WarmResult) fail(err error) {
+	r.Failed++
+	if r.Err == nil {
+		r.Err = err
+	}
+}
+
+// Warm 以最多 concurrency 个并发加载 keys 并写入本节点的缓存，concurrency <= 0 时使用默认值 8。
+// 加载与 Get 相同，由其他节点负责的 key 从对应节点获取；ctx 结束后剩余的 key 计为失败
+func (g *Group) Warm(ctx context.Context, keys []string, concurrency int) WarmResult {
+	return runWarm(ctx, len(keys), concurrency, func(i int) (bool, error) {
+		if _, ok := g.Peek(keys[i]); ok {
+			return true, nil
+		}
+		_, err := g.GetContext(ctx, keys[i])
+		return false, err
+	})
+}
+
+// runWarm 以最多 concurrency 个 goroutine 对 [0, n) 调用 load，load 返回数据是否已在缓存中
+func runWarm(ctx context.Context, n, concurrency int, load func(i int) (bool, error)) WarmResult {
+	if concurrency <= 0 {
+		concurrency = defaultWarmConcurrency
+	}
+	var res WarmResult
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			mu.Lock()
+			for ; i < n; i++ {
+				res.fail(ctx.Err())
+			}
+			mu.Unlock()
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			cached, err := load(i)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				res.fail(err)
+			case cached:
+				res.Cached++
+			default:
+				res.Loaded++
+			}
+		}(i)
+	}
+	wg.Wait()
+	return res
+}
+
+// KeyLister 是能列出远端节点缓存中 key 的 PeerGetter
+type KeyLister interface {
+	ListKeys(ctx context.Context, group string) ([]string, error)
+}
+
+// errKeysUnsupported 表示 Group 的 Store 不支持列出 key
+var errKeysUnsupported = errors.New("fatcache: store does not support listing keys")
+
+// keysBatch 是列出 key 时每次持有缓存锁复制的数量
+const keysBatch = 1024
+
+// cachedKeys 分批把本节点缓存中属于当前代数的 key 传给 fn，不包括二级缓存。
+// 每批只短暂持有缓存的锁，遍历期间被访问的 key 可能重复出现，但不会遗漏
+func (g *Group) cachedKeys(fn func(keys []string) error) error {
+	var cursor lru.Cursor
+	for {
+		cks, next, ok := g.mainCache.keysAfter(cursor, keysBatch)
+		if !ok {
+			return errKeysUnsupported
+		}
+		keys := make([]string, 0, len(cks))
+		for _, ck := range cks {
+			if key := userKey(ck); g.cacheKey(key) == ck {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if len(cks) < keysBatch {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// serveKeys 以 JSON 数组返回 group 缓存中的 key，边遍历边写入响应
+func serveKeys(w http.ResponseWriter, group *Group) {
+	n := 0
+	err := group.cachedKeys(func(keys []string) error {
+		if n == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "[")
+		}
+		for _, key := range keys {
+			b, _ := json.Marshal(key)
+			if n > 0 {
+				b = append([]byte{','}, b...)
+			}
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if n == 0 {
+		if errors.Is(err, errKeysUnsupported) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, "[")
+	}
+	io.WriteString(w, "]")
+}
+
+// ListKeys 返回远端节点 group 缓存中的 key
+func (h *httpGetter) ListKeys(ctx context.Context, group string) ([]string, error) {
+	resp, err := h.control(ctx, http.MethodGet, "keys/"+group, nil)
+	if err != nil {
+		return nil, fmt.Errorf("peer %s: %w", h.base, err)
+	}
+	defer resp.Body.Close()
+	var keys []string
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("peer %s: %w", h.base, err)
+	}
+	return keys, nil
+}
+
+var _ KeyLister = (*httpGetter)(nil)
+
+// WarmFromPeers 在本节点通过 Set 加入集群后调用：对比本节点加入前后的哈希环，
+// 从每个远端节点拉取其缓存中、加入前由它负责而现在由本节点负责的数据，
+// 每个节点最多 concurrency 个并发请求。无法列出 key 的节点计为一次失败
+func (h *HTTPPool) WarmFromPeers(ctx context.Context, group *Group, concurrency int) WarmResult {
+	h.mu.Lock()
+	names := make([]string, 0, len(h.httpGetters))
+	getters := make(map[string]*httpGetter, len(h.httpGetters))
+	for name, getter := range h.httpGetters {
+		if name != h.self {
+			names = append(names, name)
+			getters[name] = getter
+		}
+	}
+	h.mu.Unlock()
+	sort.Strings(names)
+
+	// 加入前的哈希环即去掉本节点后的哈希环
+	previous := consisitenthash.New(h.opts.Replicas, nil)
+	previous.Add(names...)
+
+	var res WarmResult
+	for _, name := range names {
+		keys, err := getters[name].ListKeys(ctx, group.name)
+		if err != nil {
+			res.fail(err)
+			continue
+		}
+		var owned []string
+		h.mu.Lock()
+		for _, key := range keys {
+			if h.peers.Get(key) == h.self && previous.Get(key) == name {
+				owned = append(owned, key)
+			}
+		}
+		h.mu.Unlock()
+		r := runWarm(ctx, len(owned), concurrency, func(i int) (bool, error) {
+			return group.pullFromPeer(ctx, getters[name], owned[i])
+		})
+		res.Loaded += r.Loaded
+		res.Cached += r.Cached
+		res.Failed += r.Failed
+		if res.Err == nil {
+			res.Err = r.Err
+		}
+	}
+	return res
+}
+
+// pullFromPeer 从 peer 获取 key 的数据和标签写入本节点的缓存，返回数据是否已在缓存中
+func (g *Group) pullFromPeer(ctx context.Context, peer PeerGetter, key string) (bool, error) {
+	if _, ok := g.Peek(key); ok {
+		return true, nil
+	}
+	since := g.tags.begin()
+	defer g.tags.end()
+	hint := &peerHint{sent: g.Generation()}
+	value, err := g.getFromPeer(withPeerHint(ctx, hint), peer, key)
+	g.observeGeneration(hint.seen.Load())
+	if err != nil {
+		return false, err
+	}
+	return false, g.populateLoaded(g.cacheKey(key), value.ByteSlice(), hint.tagList(), since)
+}
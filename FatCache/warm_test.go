@@ -0,0 +1,177 @@
+package fatcache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWarm(t *testing.T) {
+	var running, peak atomic.Int32
+	group := NewGroup("warmGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		if key == "bad" {
+			return nil, errors.New("not found")
+		}
+		return []byte("v:" + key), nil
+	}))
+
+	keys := make([]string, 20)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	res := group.Warm(context.Background(), append(keys, "bad"), 3)
+	if res.Loaded != 20 || res.Cached != 0 || res.Failed != 1 || res.Err == nil {
+		t.Fatalf("unexpected warm result %+v", res)
+	}
+	if peak.Load() > 3 {
+		t.Fatalf("expected at most 3 concurrent loads, got %d", peak.Load())
+	}
+	if v, ok := group.Peek("key7"); !ok || v.String() != "v:key7" {
+		t.Fatalf("expected warmed key in cache")
+	}
+
+	if res := group.Warm(context.Background(), keys, 0); res.Cached != 20 || res.Loaded != 0 {
+		t.Fatalf("expected all keys to be cached, got %+v", res)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := group.Warm(ctx, []string{"x", "y"}, 1); res.Failed != 2 || !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("expected canceled warm to fail every key, got %+v", res)
+	}
+}
+
+func TestWarmFromPeers(t *testing.T) {
+	nodes := startTestCluster(t, 2)
+	keys := make([]string, 200)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+	}
+	// 每个 key 都由负责的节点加载到缓存
+	if res := nodes[0].group.Warm(context.Background(), keys, 0); res.Failed != 0 {
+		t.Fatalf("unexpected warm result %+v", res)
+	}
+
+	// 第三个节点加入集群
+	joined := &testNode{node: NewNode()}
+	joined.server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		joined.pool.ServeHTTP(w, r)
+	}))
+	joined.addr = joined.server.Listener.Addr().String()
+	joined.pool = joined.node.NewHTTPPool(joined.addr, nil)
+	joined.pool.Set(nodes[0].addr, nodes[1].addr, joined.addr)
+	joined.group = joined.node.NewGroup("scores", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		atomic.AddInt32(&joined.loads, 1)
+		return []byte(joined.addr + ":" + key), nil
+	}))
+	joined.server.Start()
+	t.Cleanup(joined.server.Close)
+
+	res := joined.pool.WarmFromPeers(context.Background(), joined.group, 4)
+	if res.Failed != 0 || res.Err != nil {
+		t.Fatalf("unexpected warm result %+v", res)
+	}
+
+	var owned int
+	for _, key := range keys {
+		v, ok := joined.group.Peek(key)
+		if _, remote := joined.pool.PickPeer(key); remote {
+			if ok {
+				t.Fatalf("key %s is not owned by the joined node but was pulled", key)
+			}
+			continue
+		}
+		owned++
+		// 数据来自原先负责的节点，而不是本节点的 Getter
+		if !ok || v.String() == joined.addr+":"+key {
+			t.Fatalf("expected %s to be pulled from its previous owner, got %q", key, v.String())
+		}
+	}
+	if owned == 0 || res.Loaded != owned || joined.loads != 0 {
+		t.Fatalf("expected %d keys pulled without loading, got %+v and %d loads", owned, res, joined.loads)
+	}
+
+	if res := joined.pool.WarmFromPeers(context.Background(), joined.group, 4); res.Cached != owned || res.Loaded != 0 {
+		t.Fatalf("expected second warm to find every key cached, got %+v", res)
+	}
+}
+
+func TestListKeysUnsupported(t *testing.T) {
+	nodes := startTestCluster(t, 2)
+	group := nodes[1].node.NewGroup("noKeys", 1024, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithStore(func(maxBytes int64, onEvict func(string, []byte)) Store {
+		return &noKeysStore{}
+	}))
+	group.Set("key", []byte("value"))
+	peers := nodes[0].pool.Peers()
+	if _, err := peers[0].(KeyLister).ListKeys(context.Background(), "noKeys"); err == nil {
+		t.Fatalf("expected error for a store without key listing")
+	}
+}
+
+type noKeysStore struct{}
+
+func (noKeysStore) Add(key string, value []byte)  {}
+func (noKeysStore) Get(key string) ([]byte, bool) { return nil, false }
+func (noKeysStore) Remove(key string) bool        { return false }
+func (noKeysStore) Len() int                      { return 0 }
+
+func TestListKeysWithTimeout(t *testing.T) {
+	// 响应头之后的数据延迟到达，ctx 在读完响应前不能被释放
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "[")
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, `"a","b"]`)
+	}))
+	defer slow.Close()
+	pool := NewHTTPPoolOpts("self", &HTTPPoolOptions{Timeout: time.Second})
+	pool.Set(strings.TrimPrefix(slow.URL, "http://"))
+	keys, err := pool.Peers()[0].(KeyLister).ListKeys(context.Background(), "slow")
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected keys to be read within the timeout, got %v err %v", keys, err)
+	}
+
+	// 多批的 key 写入同一个响应
+	node := NewNode()
+	remote := node.NewHTTPPool("remote", nil)
+	group := node.NewGroup("manyKeys", 1<<24, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	const n = 3 * keysBatch
+	for i := 0; i < n; i++ {
+		group.Set(fmt.Sprintf("key%05d", i), []byte("v"))
+	}
+	server := httptest.NewServer(remote)
+	defer server.Close()
+	pool = NewHTTPPoolOpts("self", &HTTPPoolOptions{Timeout: time.Second})
+	pool.Set(strings.TrimPrefix(server.URL, "http://"))
+	keys, err = pool.Peers()[0].(KeyLister).ListKeys(context.Background(), "manyKeys")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key] = true
+	}
+	if len(keys) != n || len(seen) != n {
+		t.Fatalf("expected %d distinct keys, got %d (%d distinct)", n, len(keys), len(seen))
+	}
+}
@@ -0,0 +1,258 @@
+package fatcache
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Setter 把 Group.Set 写入的数据同步到后端存储
+type Setter interface {
+	Set(key string, value []byte) error
+}
+
+type SetterFunc func(key string, value []byte) error
+
+// 实现 Setter 接口
+func (f SetterFunc) Set(key string, value []byte) error {
+	return f(key, value)
+}
+
+// BatchSetter 是可选接口，写回队列按批次调用它，否则逐个调用 Set
+type BatchSetter interface {
+	SetBatch(entries map[string][]byte) error
+}
+
+// WithWriteThrough 让 Group.Set 先同步写入后端存储，写入失败时不更新缓存并返回错误。
+// 写入成功但数据无法缓存（例如超过缓存容量）时删除缓存中的旧值，Set 仍返回成功
+func WithWriteThrough(s Setter) GroupOption {
+	return func(g *Group) {
+		g.setter = s
+	}
+}
+
+// WriteBehindOptions 配置写回队列，零值字段使用默认值
+type WriteBehindOptions struct {
+	// BatchSize 每批写入的最大数量，队列达到该长度时立即写入，默认 100
+	BatchSize int
+	// FlushInterval 定期写入的间隔，默认 100ms
+	FlushInterval time.Duration
+	// Retries 一批写入失败后的重试次数，默认 3，负数表示不重试
+	Retries int
+	// RetryBackoff 首次重试前的等待时间，之后加倍，默认 50ms
+	RetryBackoff time.Duration
+	// OnError 在一批数据重试后仍写入失败、被丢弃时调用
+	OnError func(keys []string, err error)
+}
+
+// WithWriteBehind 让 Group.Set 只更新缓存并把数据放入写回队列，由后台按批次写入后端存储。
+// 同一 key 在写入前多次 Set 时只写入最后的值，写入前数据被淘汰时从队列中读取，
+// Close 会写入队列中剩余的数据，
+// 同名 Group 被 NewGroup 替换时旧 Group 会被 Close
+func WithWriteBehind(s Setter, opts WriteBehindOptions) GroupOption {
+	return func(g *Group) {
+		g.writeBehind = newWriteBehind(g, s, opts)
+	}
+}
+
+// writeBehind 是按 key 合并的写回队列
+type writeBehind struct {
+	group  *Group
+	setter Setter
+	opts   WriteBehindOptions
+
+	mu      sync.Mutex
+	pending map[string][]byte
+	// order 为 pending 中 key 首次入队的顺序
+	order []string
+	// writing 为已取出、正在写入的一批数据
+	writing map[string][]byte
+	// flushMu 保证同一时刻只有一批在写入，同一 key 的写入不会乱序
+	flushMu sync.Mutex
+
+	kick chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+func newWriteBehind(g *Group, s Setter, opts WriteBehindOptions) *writeBehind {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 100 * time.Millisecond
+	}
+	if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 50 * time.Millisecond
+	}
+	w := &writeBehind{
+		group:   g,
+		setter:  s,
+		opts:    opts,
+		pending: make(map[string][]byte),
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+func (w *writeBehind) enqueue(key string, value []byte) {
+	w.mu.Lock()
+	if _, ok := w.pending[key]; ok {
+		w.group.stats.writesCoalesced.Add(1)
+	} else {
+		w.order = append(w.order, key)
+	}
+	w.pending[key] = value
+	full := len(w.order) >= w.opts.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (w *writeBehind) depth() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.order)
+}
+
+func (w *writeBehind) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.kick:
+		case <-w.stop:
+			w.flush()
+			return
+		}
+		w.flush()
+	}
+}
+
+// take 取出最多 BatchSize 个待写入的数据
+func (w *writeBehind) take() map[string][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := min(len(w.order), w.opts.BatchSize)
+	if n == 0 {
+		return nil
+	}
+	batch := make(map[string][]byte, n)
+	w.writing = make(map[string][]byte, n)
+	for _, key := range w.order[:n] {
+		batch[key] = w.pending[key]
+		w.writing[key] = w.pending[key]
+		delete(w.pending, key)
+	}
+	w.order = w.order[n:]
+	return batch
+}
+
+// lookup 返回 key 尚未写入后端存储的值
+func (w *writeBehind) lookup(key string) ([]byte, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if value, ok := w.pending[key]; ok {
+		return value, true
+	}
+	value, ok := w.writing[key]
+	return value, ok
+}
+
+// flush 写入队列中的所有数据，返回最后一个失败批次的错误
+func (w *writeBehind) flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	var last error
+	for batch := w.take(); batch != nil; batch = w.take() {
+		if err := w.write(batch); err != nil {
+			last = err
+		}
+		w.mu.Lock()
+		w.writing = nil
+		w.mu.Unlock()
+	}
+	return last
+}
+
+// write 写入一批数据，失败时退避重试，重试耗尽后丢弃这批数据
+func (w *writeBehind) write(batch map[string][]byte) error {
+	stats := &w.group.stats
+	backoff := w.opts.RetryBackoff
+	var err error
+	for attempt := 0; ; attempt++ {
+		stats.writeFlushes.Add(1)
+		if err = w.writeOnce(batch); err == nil {
+			return nil
+		}
+		if attempt >= w.opts.Retries {
+			break
+		}
+		stats.writeRetries.Add(1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	stats.writeFlushFailures.Add(1)
+	keys := make([]string, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+	w.group.log(LevelError, "write back failed", F("keys", len(keys)), F("err", err))
+	if w.opts.OnError != nil {
+		w.opts.OnError(keys, err)
+	}
+	return err
+}
+
+// writeOnce 写入一批数据，逐个写入时已成功的数据从 batch 中删除，重试时只写入失败的部分
+func (w *writeBehind) writeOnce(batch map[string][]byte) error {
+	if bs, ok := w.setter.(BatchSetter); ok {
+		return bs.SetBatch(batch)
+	}
+	var errs []error
+	for key, value := range batch {
+		if err := w.setter.Set(key, value); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(batch, key)
+	}
+	return errors.Join(errs...)
+}
+
+func (w *writeBehind) close() error {
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+	return w.flush()
+}
+
+// Flush 立即写入写回队列中的所有数据，返回最后一个失败批次的错误
+func (g *Group) Flush() error {
+	if g.writeBehind == nil {
+		return nil
+	}
+	return g.writeBehind.flush()
+}
+
+// Close 停止写回队列的后台写入，并写入队列中剩余的数据
+func (g *Group) Close() error {
+	if g.writeBehind == nil {
+		return nil
+	}
+	return g.writeBehind.close()
+}
@@ -0,0 +1,181 @@
+package fatcache
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore 是测试用的后端存储，failures 为接下来需要失败的写入次数
+type memStore struct {
+	mu       sync.Mutex
+	data     map[string]string
+	batches  int
+	failures int
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string]string)}
+}
+
+func (s *memStore) Set(key string, value []byte) error {
+	return s.SetBatch(map[string][]byte{key: value})
+}
+
+func (s *memStore) SetBatch(entries map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("store unavailable")
+	}
+	s.batches++
+	for k, v := range entries {
+		s.data[k] = string(v)
+	}
+	return nil
+}
+
+func (s *memStore) get(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data[key]
+}
+
+func TestWriteThrough(t *testing.T) {
+	store := newMemStore()
+	group := NewGroup("writeThroughGroup", 1<<20, nil, WithWriteThrough(store))
+
+	if err := group.Set("key", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	if store.get("key") != "v1" || peekString(group, "key") != "v1" {
+		t.Fatalf("expected value in both store and cache")
+	}
+
+	store.failures = 1
+	if err := group.Set("key", []byte("v2")); err == nil {
+		t.Fatalf("expected write-through error")
+	}
+	if peekString(group, "key") != "v1" {
+		t.Fatalf("cache must not be updated when the store write fails")
+	}
+	if stats := group.Stats(); stats.Writes != 2 || stats.WriteErrors != 1 {
+		t.Fatalf("unexpected write stats %+v", stats)
+	}
+
+	// 后端已写入但无法缓存时删除旧值并返回成功
+	group = NewGroup("writeThroughSmallGroup", 64, nil, WithWriteThrough(store), WithLogger(NopLogger()))
+	group.Set("key", []byte("v1"))
+	if err := group.Set("key", make([]byte, 100)); err != nil {
+		t.Fatalf("expected write-through to succeed when the value cannot be cached, got %v", err)
+	}
+	if len(store.get("key")) != 100 {
+		t.Fatalf("expected value in the store")
+	}
+	if _, ok := group.Peek("key"); ok {
+		t.Fatalf("expected stale cached value to be removed")
+	}
+}
+
+func TestReplaceGroupFlushesWriteBehind(t *testing.T) {
+	store := newMemStore()
+	NewGroup("writeBehindReplaceGroup", 1<<20, nil,
+		WithWriteBehind(store, WriteBehindOptions{FlushInterval: time.Hour})).Set("key", []byte("v"))
+	NewGroup("writeBehindReplaceGroup", 1<<20, nil)
+	if store.get("key") != "v" {
+		t.Fatalf("expected queued write to be flushed when the group is replaced")
+	}
+}
+
+func TestWriteBehindCoalesce(t *testing.T) {
+	store := newMemStore()
+	group := NewGroup("writeBehindGroup", 1<<20, nil,
+		WithWriteBehind(store, WriteBehindOptions{FlushInterval: time.Hour}))
+	defer group.Close()
+
+	for _, v := range []string{"v1", "v2", "v3"} {
+		group.Set("key", []byte(v))
+	}
+	group.Set("other", []byte("x"))
+	if peekString(group, "key") != "v3" || store.get("key") != "" {
+		t.Fatalf("expected cache to be updated before the store")
+	}
+	if stats := group.Stats(); stats.WriteQueueDepth != 2 || stats.WritesCoalesced != 2 {
+		t.Fatalf("unexpected queue stats %+v", stats)
+	}
+
+	if err := group.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if store.get("key") != "v3" || store.get("other") != "x" || store.batches != 1 {
+		t.Fatalf("expected one batch with the latest values, got %v in %d batches", store.data, store.batches)
+	}
+}
+
+func TestWriteBehindReadsPending(t *testing.T) {
+	store := newMemStore()
+	group := NewGroup("writeBehindPendingGroup", 1<<20, GetterFunc(func(key string) ([]byte, error) {
+		if v := store.get(key); v != "" {
+			return []byte(v), nil
+		}
+		return nil, errors.New("not found")
+	}), WithWriteBehind(store, WriteBehindOptions{FlushInterval: time.Hour}))
+	defer group.Close()
+
+	group.Set("key", []byte("v1"))
+	// 模拟写入前被淘汰
+	group.mainCache.remove(group.cacheKey("key"))
+	if v, err := group.Get("key"); err != nil || v.String() != "v1" {
+		t.Fatalf("expected queued value before flush, got %q, err %v", v.String(), err)
+	}
+}
+
+func TestWriteBehindRetry(t *testing.T) {
+	store := newMemStore()
+	store.failures = 2
+	var failed []string
+	group := NewGroup("writeBehindRetryGroup", 1<<20, nil, WithWriteBehind(store, WriteBehindOptions{
+		FlushInterval: time.Hour,
+		RetryBackoff:  time.Millisecond,
+		Retries:       2,
+		OnError:       func(keys []string, err error) { failed = append(failed, keys...) },
+	}))
+	defer group.Close()
+
+	group.Set("key", []byte("v"))
+	if err := group.Flush(); err != nil || store.get("key") != "v" {
+		t.Fatalf("expected write to succeed after retries, err %v", err)
+	}
+
+	store.failures = 10
+	group.Set("lost", []byte("v"))
+	if err := group.Flush(); err == nil {
+		t.Fatalf("expected flush error after retries are exhausted")
+	}
+	if len(failed) != 1 || failed[0] != "lost" {
+		t.Fatalf("expected OnError for the dropped key, got %v", failed)
+	}
+	if stats := group.Stats(); stats.WriteRetries != 4 || stats.WriteFlushFailures != 1 {
+		t.Fatalf("unexpected retry stats %+v", stats)
+	}
+}
+
+func TestWriteBehindBatchSize(t *testing.T) {
+	store := newMemStore()
+	group := NewGroup("writeBehindBatchGroup", 1<<20, nil,
+		WithWriteBehind(SetterFunc(store.Set), WriteBehindOptions{BatchSize: 2, FlushInterval: time.Hour}))
+
+	group.Set("a", []byte("1"))
+	group.Set("b", []byte("2"))
+	waitFor(t, "full batch to be flushed", func() bool { return store.get("b") == "2" })
+
+	group.Set("c", []byte("3"))
+	if err := group.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if store.get("c") != "3" {
+		t.Fatalf("expected Close to flush remaining writes")
+	}
+}
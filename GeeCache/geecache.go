@@ -3,8 +3,7 @@ package geecache
 import (
 	"fmt"
 	"geecache/singleflight"
-	"log"
-	"sync"
+	"sync/atomic"
 )
 
 type Getter interface {
@@ -24,47 +23,40 @@ type Group struct {
 	name      string
 	getter    Getter
 	mainCache cache
-	peers     PeerPicker
-	loader    *singleflight.Group
+	// peers is set once, either by RegisterPeers or by the node, and is
+	// read by concurrent loads.
+	peers  atomic.Pointer[PeerPicker]
+	loader *singleflight.Group
+	logger Logger
 }
 
-var (
-	mu     sync.RWMutex
-	groups = make(map[string]*Group)
-)
-
-// NewGroup create a new instance of Group
+// NewGroup create a new instance of Group on the default node, replacing
+// any group with the same name.
 func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
-	if getter == nil {
-		panic("nil Getter")
-	}
-	mu.Lock()
-	defer mu.Unlock()
-	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
-	}
-	groups[name] = g
+	g, _ := defaultNode.addGroup(name, cacheBytes, getter, true)
 	return g
 }
 
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
-	mu.RLock()
-	g := groups[name]
-	mu.RUnlock()
-	return g
+	return defaultNode.GetGroup(name)
 }
 
 // RegisterPeers registers a PeerPicker for choosing remote peer
 func (g *Group) RegisterPeers(peers PeerPicker) {
-	if g.peers != nil {
+	if !g.peers.CompareAndSwap(nil, &peers) {
 		panic("RegisterPeerPicker called more than once")
 	}
-	g.peers = peers
+}
+
+// SetLogger sets the Logger used by the group. It must be called before
+// the group serves requests. A nil Logger discards all messages.
+func (g *Group) SetLogger(l Logger) {
+	if l == nil {
+		l = NopLogger()
+	}
+	g.logger = l
 }
 
 // Get value for a key from cache
@@ -74,7 +66,7 @@ func (g *Group) Get(key string) (ByteView, error) {
 	}
 
 	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
+		g.logger.Log(LevelDebug, "cache hit", Field{"group", g.name}, Field{"key", key})
 		return v, nil
 	}
 
@@ -85,12 +77,13 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers.
 	view, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
+		if peers := g.peers.Load(); peers != nil {
+			if peer, ok := (*peers).PickPeer(key); ok {
 				if value, err = g.getFromPeer(peer, key); err == nil {
 					return value, nil
 				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+				g.logger.Log(LevelWarn, "failed to get from peer",
+					Field{"group", g.name}, Field{"key", key}, Field{"err", err})
 			}
 		}
 
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"geecache/consistenthash"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"strings"
@@ -18,25 +17,38 @@ const (
 
 // HTTPPool implements PeerPicker for a pool of HTTP peers.
 type HTTPPool struct {
+	node *Node
 	// this peer's base URL, e.g. "https://example.net:8000"
 	self        string
 	basePath    string
 	mu          sync.Mutex // guards peers and httpGetters
 	peers       *consistenthash.Map
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+	logger      Logger
 }
 
-// NewHTTPPool initializes an HTTP pool of peers.
+// NewHTTPPool initializes an HTTP pool of peers serving the default node.
 func NewHTTPPool(self string) *HTTPPool {
 	return &HTTPPool{
+		node:     defaultNode,
 		self:     self,
 		basePath: defaultBasePath,
+		logger:   defaultLogger,
 	}
 }
 
-// Log info with server name
+// SetLogger sets the Logger used by the pool. It must be called before
+// the pool serves requests. A nil Logger discards all messages.
+func (p *HTTPPool) SetLogger(l Logger) {
+	if l == nil {
+		l = NopLogger()
+	}
+	p.logger = l
+}
+
+// Log logs a debug message with the server name
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	p.logger.Log(LevelDebug, fmt.Sprintf(format, v...), Field{"server", p.self})
 }
 
 // ServeHTTP handle all http requests
@@ -55,7 +67,7 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	groupName := parts[0]
 	key := parts[1]
 
-	group := GetGroup(groupName)
+	group := p.node.GetGroup(groupName)
 	if group == nil {
 		http.Error(w, "no such group: "+groupName, http.StatusNotFound)
 		return
@@ -0,0 +1,83 @@
+package geecache
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// A Level is the severity of a log message.
+type Level int
+
+// Log levels, from the most to the least verbose.
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// A Field is a key/value pair attached to a log message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives leveled, structured log messages. Implementations must
+// be safe for concurrent use.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// defaultLogger is used by groups and pools without their own Logger. It
+// only reports warnings and errors.
+var defaultLogger Logger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), LevelWarn)
+
+// NewStdLogger returns a Logger that writes messages at or above min to l,
+// formatted as "LEVEL msg key=value ...".
+func NewStdLogger(l *log.Logger, min Level) Logger {
+	return &stdLogger{l: l, min: min}
+}
+
+type stdLogger struct {
+	l   *log.Logger
+	min Level
+}
+
+func (s *stdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < s.min {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	s.l.Print(b.String())
+}
+
+// NopLogger returns a Logger that discards every message.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(Level, string, ...Field) {}
@@ -0,0 +1,50 @@
+package geecache
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+
+	l.Log(LevelDebug, "dropped")
+	l.Log(LevelInfo, "cache hit", Field{"group", "scores"}, Field{"key", "Tom"})
+	l.Log(LevelError, "load failed")
+
+	want := "INFO cache hit group=scores key=Tom\nERROR load failed\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	if s := Level(7).String(); s != "Level(7)" {
+		t.Fatalf("unexpected name for unknown level: %s", s)
+	}
+}
+
+func TestSetLoggerNil(t *testing.T) {
+	n := NewNode()
+	g := n.NewGroup("nilLogger", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}))
+	g.SetLogger(nil)
+	if _, err := g.Get("Tom"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the second Get is a cache hit, which is logged
+	if _, err := g.Get("Tom"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	p := n.NewHTTPPool("self")
+	p.SetLogger(nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultBasePath+"nilLogger/Tom", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Tom") {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,92 @@
+package geecache
+
+import (
+	"fmt"
+	"geecache/singleflight"
+	"sync"
+)
+
+// A Node owns a set of groups and the pool serving them, so several
+// independent nodes can run in the same process.
+type Node struct {
+	mu     sync.RWMutex
+	groups map[string]*Group
+	peers  *PeerPicker
+}
+
+// defaultNode backs the package-level NewGroup, GetGroup and NewHTTPPool.
+var defaultNode = NewNode()
+
+// NewNode creates an empty Node.
+func NewNode() *Node {
+	return &Node{groups: make(map[string]*Group)}
+}
+
+// NewGroup creates a Group owned by the node. It panics if a group with
+// the same name already exists on the node.
+func (n *Node) NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+	g, ok := n.addGroup(name, cacheBytes, getter, false)
+	if !ok {
+		panic(fmt.Sprintf("geecache: duplicate registration of group %s", name))
+	}
+	return g
+}
+
+func (n *Node) addGroup(name string, cacheBytes int64, getter Getter, replace bool) (*Group, bool) {
+	if getter == nil {
+		panic("nil Getter")
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if old, ok := n.groups[name]; ok && !replace {
+		return old, false
+	}
+	g := &Group{
+		name:      name,
+		getter:    getter,
+		mainCache: cache{cacheBytes: cacheBytes},
+		loader:    &singleflight.Group{},
+		logger:    defaultLogger,
+	}
+	if n.peers != nil {
+		g.peers.Store(n.peers)
+	}
+	n.groups[name] = g
+	return g, true
+}
+
+// GetGroup returns the named group owned by the node, or nil if there's
+// no such group.
+func (n *Node) GetGroup(name string) *Group {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.groups[name]
+}
+
+// RegisterPeers sets the PeerPicker for the node's groups, including the
+// ones created later. Groups that already have their own PeerPicker keep
+// it.
+func (n *Node) RegisterPeers(peers PeerPicker) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.peers != nil {
+		panic("RegisterPeers called more than once")
+	}
+	n.peers = &peers
+	for _, g := range n.groups {
+		g.peers.CompareAndSwap(nil, n.peers)
+	}
+}
+
+// NewHTTPPool initializes an HTTP pool serving the node's groups and
+// registers it as the node's PeerPicker.
+func (n *Node) NewHTTPPool(self string) *HTTPPool {
+	p := &HTTPPool{
+		node:     n,
+		self:     self,
+		basePath: defaultBasePath,
+		logger:   defaultLogger,
+	}
+	n.RegisterPeers(p)
+	return p
+}